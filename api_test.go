@@ -1,12 +1,26 @@
 package main
 
 import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
+	"category-api/apperrors"
+	"category-api/database"
 	"category-api/handlers"
 	"category-api/models"
+	"category-api/notifier"
+	"category-api/repositories"
+	"category-api/services"
 
 	"github.com/stretchr/testify/mock"
 )
@@ -16,9 +30,9 @@ type MockProductService struct {
 	mock.Mock
 }
 
-func (m *MockProductService) GetAll(name string) ([]models.Produk, error) {
-	args := m.Called(name)
-	return args.Get(0).([]models.Produk), args.Error(1)
+func (m *MockProductService) GetAll(filter models.ProductFilter) ([]models.Produk, int, error) {
+	args := m.Called(filter)
+	return args.Get(0).([]models.Produk), args.Int(1), args.Error(2)
 }
 
 func (m *MockProductService) GetByID(id int) (models.Produk, error) {
@@ -26,13 +40,69 @@ func (m *MockProductService) GetByID(id int) (models.Produk, error) {
 	return args.Get(0).(models.Produk), args.Error(1)
 }
 
-func (m *MockProductService) Create(p models.Produk) (models.Produk, error) {
-	args := m.Called(p)
+func (m *MockProductService) Restore(id int) (models.Produk, error) {
+	args := m.Called(id)
 	return args.Get(0).(models.Produk), args.Error(1)
 }
 
-func (m *MockProductService) Update(id int, p models.Produk) (models.Produk, error) {
-	args := m.Called(id, p)
+func (m *MockProductService) CreateVariant(productID int, v models.ProductVariant, actor string) (models.ProductVariant, error) {
+	args := m.Called(productID, v, actor)
+	return args.Get(0).(models.ProductVariant), args.Error(1)
+}
+
+func (m *MockProductService) UpdateVariant(productID, id int, v models.ProductVariant) (models.ProductVariant, error) {
+	args := m.Called(productID, id, v)
+	return args.Get(0).(models.ProductVariant), args.Error(1)
+}
+
+func (m *MockProductService) DeleteVariant(productID, id int) error {
+	args := m.Called(productID, id)
+	return args.Error(0)
+}
+
+// Export feeds fn the products passed to Return, then returns the mock's error.
+func (m *MockProductService) Export(filter models.ProductFilter, fn func(models.Produk) error) error {
+	args := m.Called(filter)
+	for _, p := range args.Get(0).([]models.Produk) {
+		if err := fn(p); err != nil {
+			return err
+		}
+	}
+	return args.Error(1)
+}
+
+func (m *MockProductService) Import(r io.Reader, format string, dryRun bool, actor string) (models.ImportResult, error) {
+	args := m.Called(r, format, dryRun, actor)
+	return args.Get(0).(models.ImportResult), args.Error(1)
+}
+
+func (m *MockProductService) AdjustStock(productID int, req models.StockAdjustmentRequest) (models.StockMovement, error) {
+	args := m.Called(productID, req)
+	return args.Get(0).(models.StockMovement), args.Error(1)
+}
+
+func (m *MockProductService) GetLowStock(categoryID string) ([]models.LowStockItem, error) {
+	args := m.Called(categoryID)
+	return args.Get(0).([]models.LowStockItem), args.Error(1)
+}
+
+func (m *MockProductService) GetStockMovements(filter models.StockMovementFilter) ([]models.StockMovement, int, error) {
+	args := m.Called(filter)
+	return args.Get(0).([]models.StockMovement), args.Int(1), args.Error(2)
+}
+
+func (m *MockProductService) GetByBarcode(code string) (models.Produk, error) {
+	args := m.Called(code)
+	return args.Get(0).(models.Produk), args.Error(1)
+}
+
+func (m *MockProductService) Create(p models.Produk, actor string) (models.Produk, error) {
+	args := m.Called(p, actor)
+	return args.Get(0).(models.Produk), args.Error(1)
+}
+
+func (m *MockProductService) Update(id int, u models.ProdukUpdate) (models.Produk, error) {
+	args := m.Called(id, u)
 	return args.Get(0).(models.Produk), args.Error(1)
 }
 
@@ -45,9 +115,9 @@ type MockCategoryService struct {
 	mock.Mock
 }
 
-func (m *MockCategoryService) GetAll() ([]models.Category, error) {
-	args := m.Called()
-	return args.Get(0).([]models.Category), args.Error(1)
+func (m *MockCategoryService) GetAll(filter models.CategoryFilter) ([]models.Category, int, error) {
+	args := m.Called(filter)
+	return args.Get(0).([]models.Category), args.Int(1), args.Error(2)
 }
 
 func (m *MockCategoryService) GetByID(id string) (models.Category, error) {
@@ -55,6 +125,26 @@ func (m *MockCategoryService) GetByID(id string) (models.Category, error) {
 	return args.Get(0).(models.Category), args.Error(1)
 }
 
+func (m *MockCategoryService) ExportSeed(filter models.CategoryFilter) (map[string]models.CategorySeed, error) {
+	args := m.Called(filter)
+	return args.Get(0).(map[string]models.CategorySeed), args.Error(1)
+}
+
+func (m *MockCategoryService) Import(r io.Reader, dryRun bool) (models.CategoryImportResult, error) {
+	args := m.Called(r, dryRun)
+	return args.Get(0).(models.CategoryImportResult), args.Error(1)
+}
+
+func (m *MockCategoryService) GetBySlug(slug string) (models.Category, error) {
+	args := m.Called(slug)
+	return args.Get(0).(models.Category), args.Error(1)
+}
+
+func (m *MockCategoryService) Tree() ([]models.CategoryNode, error) {
+	args := m.Called()
+	return args.Get(0).([]models.CategoryNode), args.Error(1)
+}
+
 func (m *MockCategoryService) Create(c models.Category) (models.Category, error) {
 	args := m.Called(c)
 	return args.Get(0).(models.Category), args.Error(1)
@@ -65,11 +155,31 @@ func (m *MockCategoryService) Update(id string, c models.Category) (models.Categ
 	return args.Get(0).(models.Category), args.Error(1)
 }
 
-func (m *MockCategoryService) Delete(id string) error {
-	args := m.Called(id)
+func (m *MockCategoryService) Delete(id string, opts models.CategoryDeleteOptions) error {
+	args := m.Called(id, opts)
 	return args.Error(0)
 }
 
+func (m *MockCategoryService) Restore(id string) (models.Category, error) {
+	args := m.Called(id)
+	return args.Get(0).(models.Category), args.Error(1)
+}
+
+func (m *MockCategoryService) Export(filter models.CategoryFilter, fn func(models.Category) error) error {
+	args := m.Called(filter)
+	for _, c := range args.Get(0).([]models.Category) {
+		if err := fn(c); err != nil {
+			return err
+		}
+	}
+	return args.Error(1)
+}
+
+func (m *MockCategoryService) GetProducts(id string, filter models.ProductFilter) ([]models.Produk, int, error) {
+	args := m.Called(id, filter)
+	return args.Get(0).([]models.Produk), args.Int(1), args.Error(2)
+}
+
 // NOTE: Since we are using standard library testing, and adding testify/mock might require downloading dependencies. 
 // If dependency download is an issue, I would write manual mocks. 
 // For now, I'll assume valid environment.
@@ -118,4 +228,1473 @@ func TestCategoryHandlerInitialization(t *testing.T) {
 	if handler == nil {
 		t.Errorf("Failed to initialize CategoryHandler")
 	}
-}
\ No newline at end of file
+}
+
+func TestGetProdukFiltersByCategory(t *testing.T) {
+	mockService := new(MockProductService)
+	mockService.On("GetAll", mock.MatchedBy(func(f models.ProductFilter) bool {
+		return f.CategoryID == "cat-1"
+	})).Return([]models.Produk{
+		{ID: 1, Nama: "Kopi Susu", Harga: 15000, Stok: 10, CategoryID: "cat-1"},
+	}, 1, nil)
+	handler := handlers.NewProductHandler(mockService)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/produk?category_id=cat-1", nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	mockService.AssertExpectations(t)
+}
+
+func TestGetCategoryProducts(t *testing.T) {
+	mockService := new(MockCategoryService)
+	mockService.On("GetProducts", "cat-1", mock.Anything).Return([]models.Produk{}, 0, nil)
+	mockService.On("GetProducts", "missing", mock.Anything).Return([]models.Produk(nil), 0, repositories.ErrCategoryNotFound)
+	handler := handlers.NewCategoryHandler(mockService)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/categories/cat-1/produk", nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if body := strings.TrimSpace(rr.Body.String()); body != "[]" {
+		t.Errorf("handler returned unexpected body: got %v want []", body)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/categories/missing/produk", nil)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusNotFound)
+	}
+}
+
+func TestEmbeddedMigrationsLoad(t *testing.T) {
+	// Every migration must ship with both up and down scripts
+	if _, err := database.NewMigrator(nil); err != nil {
+		t.Fatalf("Failed to load embedded migrations: %v", err)
+	}
+}
+
+type MockTransactionService struct {
+	mock.Mock
+}
+
+func (m *MockTransactionService) Checkout(req models.CheckoutRequest) (models.CheckoutResponse, error) {
+	args := m.Called(req)
+	return args.Get(0).(models.CheckoutResponse), args.Error(1)
+}
+
+func (m *MockTransactionService) CheckoutIdempotent(key string, req models.CheckoutRequest) (models.CheckoutResponse, bool, error) {
+	args := m.Called(key, req)
+	return args.Get(0).(models.CheckoutResponse), args.Bool(1), args.Error(2)
+}
+
+func (m *MockTransactionService) Export(filter models.TransactionFilter, fn func(models.Transaction) error) error {
+	args := m.Called(filter)
+	for _, t := range args.Get(0).([]models.Transaction) {
+		if err := fn(t); err != nil {
+			return err
+		}
+	}
+	return args.Error(1)
+}
+
+func (m *MockTransactionService) ListTransactions(filter models.TransactionFilter, cursor string) (models.TransactionListResponse, error) {
+	args := m.Called(filter, cursor)
+	return args.Get(0).(models.TransactionListResponse), args.Error(1)
+}
+
+func (m *MockTransactionService) GetTransaction(id int) (models.TransactionDetailResponse, error) {
+	args := m.Called(id)
+	return args.Get(0).(models.TransactionDetailResponse), args.Error(1)
+}
+
+func (m *MockTransactionService) Void(id int, req models.VoidRequest) (models.Reversal, error) {
+	args := m.Called(id, req)
+	return args.Get(0).(models.Reversal), args.Error(1)
+}
+
+func (m *MockTransactionService) Refund(id int, req models.RefundRequest) (models.Reversal, error) {
+	args := m.Called(id, req)
+	return args.Get(0).(models.Reversal), args.Error(1)
+}
+
+func TestTransactionReversalRoutes(t *testing.T) {
+	mockService := new(MockTransactionService)
+	mockService.On("Void", 5, models.VoidRequest{ReasonCode: "cashier_error"}).Return(models.Reversal{ID: 1, Type: models.ReversalVoid}, nil)
+	mockService.On("Void", 6, mock.Anything).Return(models.Reversal{}, repositories.ErrTransactionVoided)
+	mockService.On("Refund", 5, mock.Anything).Return(models.Reversal{}, fmt.Errorf("%w: only 1 left", repositories.ErrInvalidRefund))
+	handler := handlers.NewTransactionHandler(mockService)
+
+	tests := []struct {
+		path string
+		body string
+		want int
+	}{
+		{"/api/transactions/5/void", `{"reason_code": "cashier_error"}`, http.StatusCreated},
+		{"/api/transactions/6/void", `{"reason_code": "cashier_error"}`, http.StatusConflict},
+		{"/api/transactions/5/refund", `{"reason_code": "damaged", "items": [{"transaction_detail_id": 1, "quantity": 2}]}`, http.StatusUnprocessableEntity},
+		{"/api/transactions/5/cancel", `{}`, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != tt.want {
+			t.Errorf("POST %s returned wrong status code: got %v want %v", tt.path, rr.Code, tt.want)
+		}
+	}
+}
+
+func TestListTransactionsParsesFilters(t *testing.T) {
+	mockService := new(MockTransactionService)
+	mockService.On("ListTransactions", mock.MatchedBy(func(f models.TransactionFilter) bool {
+		return f.MinAmount == 10000 && f.ProductID == 3 && f.Limit == 5 &&
+			f.StartDate.Format("2006-01-02") == "2026-01-01" &&
+			f.EndDate.Format("2006-01-02") == "2026-01-31"
+	}), "abc").Return(models.TransactionListResponse{Data: []models.Transaction{}}, nil)
+	handler := handlers.NewTransactionHandler(mockService)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/transactions?start_date=2026-01-01&end_date=2026-01-31&min_amount=10000&product_id=3&limit=5&cursor=abc", nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	mockService.AssertExpectations(t)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/transactions?start_date=01-01-2026", nil)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+}
+
+func TestCheckoutIdempotencyKey(t *testing.T) {
+	mockService := new(MockTransactionService)
+	mockService.On("CheckoutIdempotent", "retry-1", mock.Anything).Return(models.CheckoutResponse{
+		Transaction: models.Transaction{ID: 7, TotalAmount: 30000},
+	}, true, nil)
+	mockService.On("CheckoutIdempotent", "retry-2", mock.Anything).Return(models.CheckoutResponse{}, false, services.ErrIdempotencyKeyMismatch)
+	handler := handlers.NewTransactionHandler(mockService)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/checkout", strings.NewReader(`{"items": [{"product_id": 1, "quantity": 2}]}`))
+	req.Header.Set("Idempotency-Key", "retry-1")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusCreated)
+	}
+	if rr.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("replayed response is missing the Idempotent-Replayed header")
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/checkout", strings.NewReader(`{"items": [{"product_id": 1, "quantity": 3}]}`))
+	req.Header.Set("Idempotency-Key", "retry-2")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusUnprocessableEntity)
+	}
+	mockService.AssertNotCalled(t, "Checkout", mock.Anything)
+}
+
+func TestCheckoutInsufficientStock(t *testing.T) {
+	mockService := new(MockTransactionService)
+	mockService.On("Checkout", mock.Anything).Return(models.CheckoutResponse{}, &repositories.InsufficientStockError{
+		Items: []repositories.StockShortage{{ProductID: 1, Nama: "Kopi Susu", Requested: 2, Available: 1}},
+	})
+	handler := handlers.NewTransactionHandler(mockService)
+
+	body := strings.NewReader(`{"items": [{"product_id": 1, "quantity": 2}]}`)
+	req := httptest.NewRequest(http.MethodPost, "/api/checkout", body)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusConflict {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusConflict)
+	}
+	if !strings.Contains(rr.Body.String(), `"available":1`) {
+		t.Errorf("handler response does not list the short product: %s", rr.Body.String())
+	}
+}
+
+type MockReportService struct {
+	mock.Mock
+}
+
+func (m *MockReportService) GetDailyReport() (models.DailyReportResponse, error) {
+	args := m.Called()
+	return args.Get(0).(models.DailyReportResponse), args.Error(1)
+}
+
+func (m *MockReportService) GetReport(startDate, endDate time.Time) (models.SalesReportResponse, error) {
+	args := m.Called(startDate, endDate)
+	return args.Get(0).(models.SalesReportResponse), args.Error(1)
+}
+
+func TestGetReportDateRange(t *testing.T) {
+	mockService := new(MockReportService)
+	mockService.On("GetReport", mock.Anything, mock.Anything).Return(models.SalesReportResponse{}, services.ErrInvalidDateRange)
+	handler := handlers.NewReportHandler(mockService)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/report?start_date=2026-02-01&end_date=2026-01-01", nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/report?start_date=yesterday", nil)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+	mockService.AssertNumberOfCalls(t, "GetReport", 1)
+}
+
+func TestBusinessDayCutoff(t *testing.T) {
+	wib, err := time.LoadLocation("Asia/Jakarta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	day := services.BusinessDay{Location: wib, CutoffHour: 4}
+
+	// 01:30 WIB on the 2nd is 18:30 UTC on the 1st and still belongs to the 1st
+	sale := time.Date(2026, 3, 1, 18, 30, 0, 0, time.UTC)
+	if got := day.DateOf(sale).Format("2006-01-02"); got != "2026-03-01" {
+		t.Errorf("DateOf returned %s, want 2026-03-01", got)
+	}
+
+	start := day.Start(time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC))
+	if want := time.Date(2026, 3, 1, 21, 0, 0, 0, time.UTC); !start.Equal(want) {
+		t.Errorf("Start returned %s, want %s", start.UTC(), want)
+	}
+}
+
+func TestErrorEnvelope(t *testing.T) {
+	mockService := new(MockProductService)
+	mockService.On("GetByID", 99).Return(models.Produk{}, repositories.ErrProductNotFound)
+	mockService.On("GetByID", 500).Return(models.Produk{}, errors.New(`pq: relation "products" does not exist`))
+	mux := http.NewServeMux()
+	mux.Handle("/api/produk/", handlers.NewProductHandler(mockService))
+	mux.HandleFunc("/", handlers.NotFound)
+	handler := handlers.WithRequestID(mux)
+
+	tests := []struct {
+		path string
+		want int
+		code string
+	}{
+		{"/api/produk/99", http.StatusNotFound, "product_not_found"},
+		{"/api/unknown", http.StatusNotFound, apperrors.CodeNotFound},
+		{"/api/produk/abc", http.StatusBadRequest, "invalid_id"},
+		{"/api/produk/500", http.StatusInternalServerError, "internal_error"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		req.Header.Set("X-Request-ID", "req-123")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != tt.want {
+			t.Errorf("GET %s returned wrong status code: got %v want %v", tt.path, rr.Code, tt.want)
+		}
+		if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("GET %s returned content type %q", tt.path, ct)
+		}
+		var body handlers.ErrorResponse
+		if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+			t.Fatalf("GET %s returned invalid JSON: %v", tt.path, err)
+		}
+		if body.Code != tt.code || body.RequestID != "req-123" {
+			t.Errorf("GET %s returned envelope %+v", tt.path, body)
+		}
+		if strings.Contains(body.Message, "pq:") {
+			t.Errorf("GET %s leaked a database error: %s", tt.path, body.Message)
+		}
+	}
+}
+
+func TestDeleteCategoryErrorStatuses(t *testing.T) {
+	mockService := new(MockCategoryService)
+	mockService.On("Delete", "missing", models.CategoryDeleteOptions{}).Return(repositories.ErrCategoryNotFound)
+	mockService.On("Delete", "in-use", models.CategoryDeleteOptions{}).Return(repositories.ErrCategoryInUse)
+	handler := handlers.NewCategoryHandler(mockService)
+
+	tests := map[string]int{
+		"/api/categories/missing": http.StatusNotFound,
+		"/api/categories/in-use":  http.StatusConflict,
+	}
+	for path, want := range tests {
+		req := httptest.NewRequest(http.MethodDelete, path, nil)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != want {
+			t.Errorf("DELETE %s returned wrong status code: got %v want %v", path, rr.Code, want)
+		}
+	}
+}
+
+func TestGetProdukPagination(t *testing.T) {
+	mockService := new(MockProductService)
+	mockService.On("GetAll", mock.MatchedBy(func(f models.ProductFilter) bool {
+		return f.Page == 2 && f.Limit == 10 && f.Sort == "harga,-nama" &&
+			f.MinHarga != nil && *f.MinHarga == 5000 && f.MaxStok != nil && *f.MaxStok == 0
+	})).Return([]models.Produk{{ID: 11, Nama: "Teh", Harga: 5000}}, 35, nil)
+	handler := handlers.NewProductHandler(mockService)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/produk?page=2&limit=10&sort=harga,-nama&min_harga=5000&max_stok=0", nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if got := rr.Header().Get("X-Total-Count"); got != "35" {
+		t.Errorf("X-Total-Count = %q, want 35", got)
+	}
+	link := rr.Header().Get("Link")
+	for _, rel := range []string{`page=1&sort=harga%2C-nama>; rel="prev"`, `page=3&sort=harga%2C-nama>; rel="next"`, `page=4&sort=harga%2C-nama>; rel="last"`} {
+		if !strings.Contains(link, rel) {
+			t.Errorf("Link header %q does not contain %q", link, rel)
+		}
+	}
+	mockService.AssertExpectations(t)
+}
+
+func TestGetProdukByBarcode(t *testing.T) {
+	mockService := new(MockProductService)
+	mockService.On("GetByBarcode", "8991234567890").Return(models.Produk{
+		ID: 7, Nama: "Kopi Susu", Harga: 15000, SKU: "KOPI-SUSU", Barcodes: []string{"8991234567890"},
+	}, nil)
+	mockService.On("GetByBarcode", "0000").Return(models.Produk{}, repositories.ErrProductNotFound)
+	handler := handlers.NewProductHandler(mockService)
+
+	tests := []struct {
+		method string
+		path   string
+		status int
+	}{
+		{http.MethodGet, "/api/produk/barcode/8991234567890", http.StatusOK},
+		{http.MethodGet, "/api/produk/barcode/0000", http.StatusNotFound},
+		{http.MethodPost, "/api/produk/barcode/8991234567890", http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != tt.status {
+			t.Errorf("%s %s: got status %d, want %d", tt.method, tt.path, rr.Code, tt.status)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/produk/barcode/8991234567890", nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	var p models.Produk
+	if err := json.NewDecoder(rr.Body).Decode(&p); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if p.ID != 7 || p.SKU != "KOPI-SUSU" {
+		t.Errorf("unexpected product %+v", p)
+	}
+}
+
+func TestProductVariantRoutes(t *testing.T) {
+	variant := models.ProductVariant{Options: map[string]string{"size": "L"}, Harga: 90000, Stok: 5}
+	mockService := new(MockProductService)
+	mockService.On("CreateVariant", 3, variant, "").Return(models.ProductVariant{ID: 1, ProductID: 3, Options: variant.Options, Harga: 90000, Stok: 5}, nil)
+	mockService.On("UpdateVariant", 3, 1, variant).Return(models.ProductVariant{ID: 1, ProductID: 3}, nil)
+	mockService.On("DeleteVariant", 3, 9).Return(repositories.ErrVariantNotFound)
+	handler := handlers.NewProductHandler(mockService)
+
+	body := `{"options":{"size":"L"},"harga":90000,"stok":5}`
+	tests := []struct {
+		method string
+		path   string
+		status int
+	}{
+		{http.MethodPost, "/api/produk/3/variants", http.StatusCreated},
+		{http.MethodPut, "/api/produk/3/variants/1", http.StatusOK},
+		{http.MethodDelete, "/api/produk/3/variants/9", http.StatusNotFound},
+		{http.MethodGet, "/api/produk/3/variants", http.StatusMethodNotAllowed},
+		{http.MethodPut, "/api/produk/abc/variants/1", http.StatusBadRequest},
+		{http.MethodPut, "/api/produk/3/variantsx", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != tt.status {
+			t.Errorf("%s %s: got status %d, want %d", tt.method, tt.path, rr.Code, tt.status)
+		}
+	}
+	mockService.AssertExpectations(t)
+}
+
+func TestImportProdukRoute(t *testing.T) {
+	rejected := []models.ImportRowError{{Line: 3, Message: "nama is required"}}
+	mockService := new(MockProductService)
+	mockService.On("Import", mock.Anything, "csv", true, "").Return(models.ImportResult{DryRun: true, Total: 2, Errors: rejected}, nil)
+	mockService.On("Import", mock.Anything, "json", false, "").Return(models.ImportResult{}, services.ErrImportRejected.WithDetails(rejected))
+	handler := handlers.NewProductHandler(mockService)
+
+	csvBody := "sku,nama,harga,stok\nKOPI-1,Kopi,15000,10\nTEH-1,,5000,3\n"
+	req := httptest.NewRequest(http.MethodPost, "/api/produk/import?dry_run=true", strings.NewReader(csvBody))
+	req.Header.Set("Content-Type", "text/csv; charset=utf-8")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("dry run: got status %d, want %d", rr.Code, http.StatusOK)
+	}
+	var result models.ImportResult
+	if err := json.NewDecoder(rr.Body).Decode(&result); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if !result.DryRun || len(result.Errors) != 1 || result.Errors[0].Line != 3 {
+		t.Errorf("unexpected dry run result %+v", result)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/produk/import", strings.NewReader(`[{"nama":""}]`))
+	req.Header.Set("Content-Type", "application/json")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("import: got status %d, want %d", rr.Code, http.StatusUnprocessableEntity)
+	}
+	var body handlers.ErrorResponse
+	if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if body.Code != "import_rejected" {
+		t.Errorf("got code %q, want import_rejected", body.Code)
+	}
+	mockService.AssertExpectations(t)
+}
+
+func TestExportProduk(t *testing.T) {
+	products := []models.Produk{
+		{ID: 1, SKU: "KOPI-1", Nama: "Kopi, Susu", Harga: 15000, Stok: 10, Barcodes: []string{"111", "222"}},
+		{ID: 2, Nama: "Teh <Manis>", Harga: 5000},
+	}
+	mockService := new(MockProductService)
+	mockService.On("Export", mock.MatchedBy(func(f models.ProductFilter) bool { return f.CategoryID == "cat-1" })).Return(products, nil)
+	handler := handlers.NewProductHandler(mockService)
+
+	export := func(format string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/produk/export?category_id=cat-1&format="+format, nil)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := export("csv")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("csv: got status %d, want %d", rr.Code, http.StatusOK)
+	}
+	wantCSV := "id,sku,nama,harga,harga_pokok,stok,reorder_point,category_id,barcodes\n1,KOPI-1,\"Kopi, Susu\",15000,0,10,0,,111|222\n2,,Teh <Manis>,5000,0,0,0,,\n"
+	if rr.Body.String() != wantCSV {
+		t.Errorf("csv body = %q, want %q", rr.Body.String(), wantCSV)
+	}
+	if !strings.Contains(rr.Header().Get("Content-Disposition"), ".csv") {
+		t.Errorf("unexpected Content-Disposition %q", rr.Header().Get("Content-Disposition"))
+	}
+
+	rr = export("ndjson")
+	lines := strings.Split(strings.TrimSpace(rr.Body.String()), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], `{"id":1,"sku":"KOPI-1","nama":"Kopi, Susu"`) {
+		t.Errorf("unexpected ndjson body %q", rr.Body.String())
+	}
+
+	rr = export("xlsx")
+	zr, err := zip.NewReader(bytes.NewReader(rr.Body.Bytes()), int64(rr.Body.Len()))
+	if err != nil {
+		t.Fatalf("xlsx is not a zip archive: %v", err)
+	}
+	var sheet string
+	for _, f := range zr.File {
+		if f.Name == "xl/worksheets/sheet1.xml" {
+			rc, _ := f.Open()
+			var buf bytes.Buffer
+			buf.ReadFrom(rc)
+			rc.Close()
+			sheet = buf.String()
+		}
+	}
+	if !strings.Contains(sheet, `<c r="C3" t="inlineStr"><is><t xml:space="preserve">Teh &lt;Manis&gt;</t></is></c>`) ||
+		!strings.Contains(sheet, `<c r="D2"><v>15000</v></c>`) {
+		t.Errorf("unexpected worksheet %s", sheet)
+	}
+
+	if rr := export("pdf"); rr.Code != http.StatusBadRequest {
+		t.Errorf("pdf: got status %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+}
+
+func TestSoftDeleteRestoreRoutes(t *testing.T) {
+	productService := new(MockProductService)
+	productService.On("Restore", 5).Return(models.Produk{ID: 5, Nama: "Kopi"}, nil)
+	productService.On("Restore", 6).Return(models.Produk{}, repositories.ErrProductNotFound)
+	productService.On("GetAll", mock.MatchedBy(func(f models.ProductFilter) bool { return f.IncludeDeleted })).
+		Return([]models.Produk{}, 0, nil)
+	categoryService := new(MockCategoryService)
+	categoryService.On("Restore", "cat-1").Return(models.Category{ID: "cat-1", Name: "Minuman"}, nil)
+	productHandler := handlers.NewProductHandler(productService)
+	categoryHandler := handlers.NewCategoryHandler(categoryService)
+
+	tests := []struct {
+		handler http.Handler
+		method  string
+		path    string
+		status  int
+	}{
+		{productHandler, http.MethodPost, "/api/produk/5/restore", http.StatusOK},
+		{productHandler, http.MethodPost, "/api/produk/6/restore", http.StatusNotFound},
+		{productHandler, http.MethodGet, "/api/produk/5/restore", http.StatusMethodNotAllowed},
+		{productHandler, http.MethodGet, "/api/produk?include_deleted=true", http.StatusOK},
+		{productHandler, http.MethodGet, "/api/produk?include_deleted=maybe", http.StatusBadRequest},
+		{categoryHandler, http.MethodPost, "/api/categories/cat-1/restore", http.StatusOK},
+		{categoryHandler, http.MethodDelete, "/api/categories/cat-1/restore", http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		rr := httptest.NewRecorder()
+		tt.handler.ServeHTTP(rr, req)
+		if rr.Code != tt.status {
+			t.Errorf("%s %s: got status %d, want %d", tt.method, tt.path, rr.Code, tt.status)
+		}
+	}
+	productService.AssertExpectations(t)
+	categoryService.AssertExpectations(t)
+}
+
+func TestGrossProfitMargin(t *testing.T) {
+	p := models.Produk{Harga: 15000, HargaPokok: 9000}
+	p.SetMargin()
+	if p.Margin != 6000 || p.MarginPct != 40 {
+		t.Errorf("got margin %d (%v%%), want 6000 (40%%)", p.Margin, p.MarginPct)
+	}
+
+	gp := models.NewGrossProfit(30000, 20000)
+	if gp.GrossProfit != 10000 || gp.MarginPercent != 33.33 {
+		t.Errorf("got gross profit %+v", gp)
+	}
+	if gp := models.NewGrossProfit(0, 500); gp.MarginPercent != 0 || gp.GrossProfit != -500 {
+		t.Errorf("got gross profit %+v for a period without revenue", gp)
+	}
+}
+
+func TestStockLedgerRoutes(t *testing.T) {
+	adjustment := models.StockAdjustmentRequest{Type: models.StockReceiving, Quantity: 12, Reference: "PO-17", Actor: "budi"}
+	mockService := new(MockProductService)
+	mockService.On("AdjustStock", 3, adjustment).Return(models.StockMovement{ID: 1, ProductID: 3, Type: models.StockReceiving, Quantity: 12, StokAfter: 20}, nil)
+	mockService.On("GetStockMovements", models.StockMovementFilter{ProductID: 3, Type: models.StockSale, Pagination: models.Pagination{Page: 2, Limit: 1}}).
+		Return([]models.StockMovement{{ID: 4, ProductID: 3, Type: models.StockSale, Quantity: -2}}, 3, nil)
+	handler := handlers.NewProductHandler(mockService)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/produk/3/stock-adjustments", strings.NewReader(`{"type":"receiving","quantity":12,"reference":"PO-17"}`))
+	req.Header.Set("X-Actor", "budi")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Errorf("adjust: got status %d, want %d", rr.Code, http.StatusCreated)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/produk/3/stock-movements?type=sale&page=2&limit=1", nil))
+	if rr.Code != http.StatusOK || rr.Header().Get("X-Total-Count") != "3" {
+		t.Errorf("movements: got status %d and total %q", rr.Code, rr.Header().Get("X-Total-Count"))
+	}
+
+	for _, tt := range []struct {
+		method string
+		path   string
+		status int
+	}{
+		{http.MethodGet, "/api/produk/3/stock-adjustments", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/api/produk/abc/stock-movements", http.StatusBadRequest},
+		{http.MethodGet, "/api/produk/3/stock-levels", http.StatusNotFound},
+	} {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(tt.method, tt.path, nil))
+		if rr.Code != tt.status {
+			t.Errorf("%s %s: got status %d, want %d", tt.method, tt.path, rr.Code, tt.status)
+		}
+	}
+	mockService.AssertExpectations(t)
+
+	// Invalid adjustments are rejected before reaching the repositories
+	service := services.NewProductService(nil, nil, nil, nil)
+	for _, req := range []models.StockAdjustmentRequest{
+		{Type: models.StockAdjustment, Quantity: -3},
+		{Type: models.StockTransferOut, Quantity: -3},
+		{Type: models.StockSale, Quantity: 1},
+	} {
+		if _, err := service.AdjustStock(3, req); !errors.Is(err, apperrors.New(0, apperrors.CodeValidation, "")) {
+			t.Errorf("%+v: got %v, want a validation error", req, err)
+		}
+	}
+}
+
+func TestLowStockAlerts(t *testing.T) {
+	mockService := new(MockProductService)
+	mockService.On("GetLowStock", "cat-1").Return([]models.LowStockItem{{ProductID: 3, Nama: "Kopi", Stok: 2, ReorderPoint: 5}}, nil)
+	handler := handlers.NewProductHandler(mockService)
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/produk/low-stock?category_id=cat-1", nil))
+	var items []models.LowStockItem
+	if err := json.NewDecoder(rr.Body).Decode(&items); err != nil || rr.Code != http.StatusOK || len(items) != 1 {
+		t.Errorf("low-stock: got status %d, items %+v, err %v", rr.Code, items, err)
+	}
+	mockService.AssertExpectations(t)
+
+	received := make(chan map[string]interface{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&payload)
+		received <- payload
+	}))
+	defer server.Close()
+
+	n, err := notifier.New(notifier.Config{Channels: []string{"log", "webhook"}, WebhookURL: server.URL})
+	if err != nil {
+		t.Fatalf("notifier.New: %v", err)
+	}
+	if err := n.NotifyLowStock(models.LowStockAlert{TransactionID: 9, Items: items}); err != nil {
+		t.Fatalf("NotifyLowStock: %v", err)
+	}
+	if payload := <-received; payload["event"] != "low_stock" {
+		t.Errorf("unexpected webhook payload %v", payload)
+	}
+
+	if _, err := notifier.New(notifier.Config{Channels: []string{"sms"}}); err == nil {
+		t.Error("expected an error for an unknown channel")
+	}
+	if _, err := notifier.New(notifier.Config{Channels: []string{"email"}}); err == nil {
+		t.Error("expected an error for email without recipients")
+	}
+}
+
+// MockCategoryRepository backs the category service in tests of its own logic.
+type MockCategoryRepository struct {
+	mock.Mock
+}
+
+func (m *MockCategoryRepository) GetAll(filter models.CategoryFilter) ([]models.Category, int, error) {
+	args := m.Called(filter)
+	return args.Get(0).([]models.Category), args.Int(1), args.Error(2)
+}
+
+// Each feeds fn the categories passed to Return, then returns the mock's error.
+func (m *MockCategoryRepository) Each(filter models.CategoryFilter, fn func(models.Category) error) error {
+	args := m.Called(filter)
+	for _, c := range args.Get(0).([]models.Category) {
+		if err := fn(c); err != nil {
+			return err
+		}
+	}
+	return args.Error(1)
+}
+
+func (m *MockCategoryRepository) GetByID(id string) (models.Category, error) {
+	args := m.Called(id)
+	return args.Get(0).(models.Category), args.Error(1)
+}
+
+func (m *MockCategoryRepository) GetBySlug(slug string) (models.Category, error) {
+	args := m.Called(slug)
+	return args.Get(0).(models.Category), args.Error(1)
+}
+
+func (m *MockCategoryRepository) GetSlugs(base string) (map[string]bool, error) {
+	args := m.Called(base)
+	slugs, _ := args.Get(0).(map[string]bool)
+	return slugs, args.Error(1)
+}
+
+func (m *MockCategoryRepository) Create(c models.Category) (models.Category, error) {
+	args := m.Called(c)
+	return args.Get(0).(models.Category), args.Error(1)
+}
+
+func (m *MockCategoryRepository) Update(id string, c models.Category) (models.Category, error) {
+	args := m.Called(id, c)
+	return args.Get(0).(models.Category), args.Error(1)
+}
+
+func (m *MockCategoryRepository) Delete(id string, opts models.CategoryDeleteOptions) error {
+	return m.Called(id, opts).Error(0)
+}
+
+func (m *MockCategoryRepository) Restore(id string) (models.Category, error) {
+	args := m.Called(id)
+	return args.Get(0).(models.Category), args.Error(1)
+}
+
+func (m *MockCategoryRepository) Import(categories []models.Category) (int, int, error) {
+	args := m.Called(categories)
+	return args.Int(0), args.Int(1), args.Error(2)
+}
+
+func (m *MockCategoryRepository) GetPath(id string) ([]models.CategoryRef, error) {
+	args := m.Called(id)
+	path, _ := args.Get(0).([]models.CategoryRef)
+	return path, args.Error(1)
+}
+
+func TestCategoryHierarchy(t *testing.T) {
+	path := []models.CategoryRef{{ID: "minuman", Name: "Minuman"}, {ID: "kopi", Name: "Kopi"}, {ID: "kopi-susu", Name: "Kopi Susu"}}
+	repo := new(MockCategoryRepository)
+	repo.On("GetPath", "kopi-susu").Return(path, nil)
+	repo.On("GetPath", "hilang").Return(nil, repositories.ErrCategoryNotFound)
+	repo.On("GetByID", "kopi-susu").Return(models.Category{ID: "kopi-susu", Name: "Kopi Susu", ParentID: "kopi"}, nil)
+	repo.On("Each", models.CategoryFilter{Sort: "name"}).Return([]models.Category{
+		{ID: "kopi", Name: "Kopi", ParentID: "minuman"},
+		{ID: "kopi-susu", Name: "Kopi Susu", ParentID: "kopi"},
+		{ID: "minuman", Name: "Minuman"},
+		{ID: "teh", Name: "Teh", ParentID: "dihapus"},
+	}, nil)
+	service := services.NewCategoryService(repo, nil)
+
+	tests := []struct {
+		id       string
+		parentID string
+		want     error
+	}{
+		{"kopi", "kopi", services.ErrCategoryCycle},
+		{"kopi", "kopi-susu", services.ErrCategoryCycle},
+		{"kopi", "hilang", services.ErrInvalidParentCategory},
+	}
+	for _, tt := range tests {
+		_, err := service.Update(tt.id, models.Category{Name: "Kopi", ParentID: tt.parentID})
+		if !errors.Is(err, tt.want) {
+			t.Errorf("move %s under %s: got %v, want %v", tt.id, tt.parentID, err, tt.want)
+		}
+	}
+
+	c, err := service.GetByID("kopi-susu")
+	if err != nil || len(c.Path) != 3 || c.Path[0].ID != "minuman" {
+		t.Errorf("got breadcrumb %+v, err %v", c.Path, err)
+	}
+
+	tree, err := service.Tree()
+	if err != nil {
+		t.Fatalf("Tree: %v", err)
+	}
+	if len(tree) != 2 || tree[0].ID != "minuman" || tree[1].ID != "teh" {
+		t.Fatalf("unexpected roots %+v", tree)
+	}
+	if kopi := tree[0].Children; len(kopi) != 1 || len(kopi[0].Children) != 1 || kopi[0].Children[0].ID != "kopi-susu" {
+		t.Errorf("unexpected subtree %+v", kopi)
+	}
+	repo.AssertNotCalled(t, "Update", mock.Anything, mock.Anything)
+
+	mockService := new(MockCategoryService)
+	mockService.On("Tree").Return([]models.CategoryNode(nil), nil)
+	rr := httptest.NewRecorder()
+	handlers.NewCategoryHandler(mockService).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/categories/tree", nil))
+	if rr.Code != http.StatusOK || strings.TrimSpace(rr.Body.String()) != "[]" {
+		t.Errorf("tree: got status %d, body %q", rr.Code, rr.Body.String())
+	}
+}
+
+func TestCategoryIntegrity(t *testing.T) {
+	repo := new(MockCategoryRepository)
+	repo.On("GetSlugs", "kopi-susu").Return(map[string]bool{"kopi-susu": true, "kopi-susu-2": true}, nil)
+	repo.On("Create", mock.MatchedBy(func(c models.Category) bool { return c.Slug == "kopi-susu-3" })).
+		Return(models.Category{ID: "c1", Name: "Kopi Susu", Slug: "kopi-susu-3"}, nil)
+	repo.On("Create", mock.MatchedBy(func(c models.Category) bool { return c.Slug == "teh" })).
+		Return(models.Category{}, repositories.ErrDuplicate.WithDetails(map[string]string{"constraint": "categories_name_lower_key"}))
+	repo.On("GetPath", "kopi-susu").Return([]models.CategoryRef{{ID: "kopi"}, {ID: "kopi-susu"}}, nil)
+	repo.On("GetPath", "teh").Return([]models.CategoryRef{{ID: "teh"}}, nil)
+	repo.On("GetPath", "c1").Return([]models.CategoryRef{{ID: "c1"}}, nil)
+	repo.On("GetPath", "hilang").Return(nil, repositories.ErrCategoryNotFound)
+	repo.On("Delete", "kopi", models.CategoryDeleteOptions{ReassignTo: "teh"}).Return(nil)
+	// arsip only reaches kopi through a deleted category, which GetPath hides
+	repo.On("GetPath", "arsip").Return([]models.CategoryRef{{ID: "arsip"}}, nil)
+	repo.On("Delete", "kopi", models.CategoryDeleteOptions{ReassignTo: "arsip"}).Return(repositories.ErrCategoryCycle)
+	service := services.NewCategoryService(repo, nil)
+
+	c, err := service.Create(models.Category{Name: "  Kopi Susu! "})
+	if err != nil || c.Slug != "kopi-susu-3" {
+		t.Errorf("Create: got slug %q, err %v", c.Slug, err)
+	}
+	if _, err := service.Create(models.Category{Name: "TEH", Slug: "Teh"}); !errors.Is(err, services.ErrCategoryNameTaken) {
+		t.Errorf("duplicate name: got %v", err)
+	}
+
+	deletes := []struct {
+		opts models.CategoryDeleteOptions
+		want error
+	}{
+		{models.CategoryDeleteOptions{ReassignTo: "teh", Cascade: true}, apperrors.BadRequest(apperrors.CodeValidation, "")},
+		{models.CategoryDeleteOptions{ReassignTo: "kopi"}, services.ErrInvalidReassignTarget},
+		{models.CategoryDeleteOptions{ReassignTo: "kopi-susu"}, services.ErrInvalidReassignTarget},
+		{models.CategoryDeleteOptions{ReassignTo: "hilang"}, services.ErrInvalidReassignTarget},
+		{models.CategoryDeleteOptions{ReassignTo: "arsip"}, services.ErrInvalidReassignTarget},
+		{models.CategoryDeleteOptions{ReassignTo: "teh"}, nil},
+	}
+	for _, tt := range deletes {
+		if err := service.Delete("kopi", tt.opts); !errors.Is(err, tt.want) {
+			t.Errorf("Delete(kopi, %+v): got %v, want %v", tt.opts, err, tt.want)
+		}
+	}
+	repo.AssertNumberOfCalls(t, "Delete", 2)
+
+	mockService := new(MockCategoryService)
+	mockService.On("GetBySlug", "kopi-susu").Return(models.Category{ID: "c1", Slug: "kopi-susu"}, nil)
+	mockService.On("Delete", "kopi", models.CategoryDeleteOptions{Cascade: true}).Return(nil)
+	handler := handlers.NewCategoryHandler(mockService)
+	routes := []struct {
+		method, path string
+		want         int
+	}{
+		{http.MethodGet, "/api/categories/by-slug/kopi-susu", http.StatusOK},
+		{http.MethodPost, "/api/categories/by-slug/kopi-susu", http.StatusMethodNotAllowed},
+		{http.MethodDelete, "/api/categories/kopi?cascade=true", http.StatusOK},
+		{http.MethodDelete, "/api/categories/kopi?cascade=maybe", http.StatusBadRequest},
+	}
+	for _, tt := range routes {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(tt.method, tt.path, nil))
+		if rr.Code != tt.want {
+			t.Errorf("%s %s: got status %d, want %d", tt.method, tt.path, rr.Code, tt.want)
+		}
+	}
+	mockService.AssertExpectations(t)
+}
+
+func TestCategorySeedImport(t *testing.T) {
+	deleted := time.Now()
+	repo := new(MockCategoryRepository)
+	repo.On("Each", models.CategoryFilter{IncludeDeleted: true}).Return([]models.Category{
+		{ID: "minuman", Name: "Minuman", Slug: "minuman"},
+		{ID: "lama", Name: "Lama", Slug: "kopi", DeletedAt: &deleted},
+	}, nil)
+	repo.On("Import", mock.Anything).Return(1, 1, nil)
+	service := services.NewCategoryService(repo, nil)
+
+	seed := `{
+		"kopi": {"id": "kopi", "name": "Kopi", "description": "", "parent_id": "minuman"},
+		"minuman": {"id": "minuman", "name": "Minuman", "description": "Semua minuman"}
+	}`
+	result, err := service.Import(strings.NewReader(seed), false)
+	if err != nil || result.Created != 1 || result.Updated != 1 {
+		t.Fatalf("Import: got %+v, err %v", result, err)
+	}
+	written := repo.Calls[len(repo.Calls)-1].Arguments.Get(0).([]models.Category)
+	if len(written) != 2 || written[0].ID != "minuman" || written[0].Slug != "minuman" || written[1].Slug != "kopi-2" {
+		t.Errorf("unexpected upserts %+v", written)
+	}
+
+	invalid := `{
+		"a": {"id": "b", "name": "A"},
+		"c": {"name": "minuman"},
+		"d": {"name": "D", "parent_id": "e"},
+		"e": {"name": "E", "parent_id": "d"},
+		"f": {"name": "F", "parent_id": "lama"},
+		"g": {"name": "` + strings.Repeat("é", 100) + `"},
+		"h": {"name": "` + strings.Repeat("é", 101) + `"}
+	}`
+	result, err = service.Import(strings.NewReader(invalid), true)
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	var ids []string
+	for _, e := range result.Errors {
+		ids = append(ids, e.ID)
+	}
+	if strings.Join(ids, ",") != "a,c,d,e,f,h" {
+		t.Errorf("got errors %+v", result.Errors)
+	}
+	if _, err := service.Import(strings.NewReader(invalid), false); !errors.Is(err, services.ErrImportRejected) {
+		t.Errorf("got %v, want ErrImportRejected", err)
+	}
+	repo.AssertNumberOfCalls(t, "Import", 1)
+
+	mockService := new(MockCategoryService)
+	mockService.On("ExportSeed", mock.Anything).Return(map[string]models.CategorySeed{
+		"kopi": {ID: "kopi", Name: "Kopi", Slug: "kopi"},
+	}, nil)
+	rr := httptest.NewRecorder()
+	handlers.NewCategoryHandler(mockService).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/categories/export?format=json", nil))
+	var exported map[string]models.CategorySeed
+	if err := json.Unmarshal(rr.Body.Bytes(), &exported); err != nil || exported["kopi"].Name != "Kopi" {
+		t.Errorf("export: got status %d, body %q", rr.Code, rr.Body.String())
+	}
+}
+
+// MockPromoRepository backs the promo service in tests of its own logic.
+type MockPromoRepository struct {
+	mock.Mock
+}
+
+func (m *MockPromoRepository) GetAll() ([]models.PromoCode, error) {
+	args := m.Called()
+	return args.Get(0).([]models.PromoCode), args.Error(1)
+}
+
+func (m *MockPromoRepository) GetByID(id int) (models.PromoCode, error) {
+	args := m.Called(id)
+	return args.Get(0).(models.PromoCode), args.Error(1)
+}
+
+func (m *MockPromoRepository) Create(p models.PromoCode) (models.PromoCode, error) {
+	args := m.Called(p)
+	return args.Get(0).(models.PromoCode), args.Error(1)
+}
+
+func (m *MockPromoRepository) Update(id int, p models.PromoCode) (models.PromoCode, error) {
+	args := m.Called(id, p)
+	return args.Get(0).(models.PromoCode), args.Error(1)
+}
+
+func (m *MockPromoRepository) Delete(id int) error {
+	return m.Called(id).Error(0)
+}
+
+func TestDiscountsAndPromoCodes(t *testing.T) {
+	amounts := []struct {
+		discount models.Discount
+		base     int
+		want     int
+	}{
+		{models.Discount{Type: models.DiscountPercentage, Value: 10}, 15500, 1550},
+		{models.Discount{Type: models.DiscountPercentage, Value: 15}, 999, 149},
+		{models.Discount{Type: models.DiscountFixed, Value: 5000}, 12000, 5000},
+		{models.Discount{Type: models.DiscountFixed, Value: 5000}, 3000, 3000},
+	}
+	for _, tt := range amounts {
+		if got := tt.discount.Amount(tt.base); got != tt.want {
+			t.Errorf("%+v.Amount(%d) = %d, want %d", tt.discount, tt.base, got, tt.want)
+		}
+	}
+
+	spreads := []struct {
+		total   int
+		amounts []int
+		want    []int
+	}{
+		{1000, []int{3000, 1000}, []int{750, 250}},
+		{100, []int{100, 100, 100}, []int{34, 33, 33}},
+		{2, []int{1, 1, 1}, []int{1, 1, 0}},
+		{5, []int{333, 667}, []int{2, 3}},
+		{1500, []int{1000, 0, 500}, []int{1000, 0, 500}},
+		{10, []int{0, 0}, []int{0, 0}},
+		{0, []int{4000, 2000}, []int{0, 0}},
+	}
+	for _, tt := range spreads {
+		got := models.SpreadDiscount(tt.total, tt.amounts)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("SpreadDiscount(%d, %v) = %v, want %v", tt.total, tt.amounts, got, tt.want)
+		}
+		var sum, base int
+		for i, share := range got {
+			if share > tt.amounts[i] {
+				t.Errorf("SpreadDiscount(%d, %v): line %d discounted below zero", tt.total, tt.amounts, i)
+			}
+			sum += share
+			base += tt.amounts[i]
+		}
+		if base > 0 && sum != tt.total {
+			t.Errorf("SpreadDiscount(%d, %v): shares add up to %d", tt.total, tt.amounts, sum)
+		}
+	}
+
+	checkout := services.NewTransactionService(nil, nil, nil, time.Hour, services.BusinessDay{Location: time.UTC}, nil)
+	for _, req := range []models.CheckoutRequest{
+		{Items: []models.CheckoutItem{{ProductID: 1, Quantity: 1, Discount: &models.Discount{Type: models.DiscountPercentage, Value: 120}}}},
+		{Items: []models.CheckoutItem{{ProductID: 1, Quantity: 1}}, Discount: &models.Discount{Type: "bogo", Value: 1}},
+	} {
+		if _, err := checkout.Checkout(req); apperrors.From(err).Code != apperrors.CodeValidation {
+			t.Errorf("Checkout(%+v): got %v, want a validation error", req, err)
+		}
+	}
+
+	repo := new(MockPromoRepository)
+	repo.On("Create", mock.MatchedBy(func(p models.PromoCode) bool { return p.Code == "HEMAT10" && p.Active })).
+		Return(models.PromoCode{ID: 1, Code: "HEMAT10", Active: true}, nil)
+	repo.On("Create", mock.MatchedBy(func(p models.PromoCode) bool { return p.Code == "LAMA" })).
+		Return(models.PromoCode{}, repositories.ErrDuplicate)
+	repo.On("Update", 1, mock.MatchedBy(func(p models.PromoCode) bool { return p.Code == "HEMAT10" && p.Active })).
+		Return(models.PromoCode{ID: 1, Code: "HEMAT10", Active: true}, nil)
+	repo.On("Update", 1, mock.MatchedBy(func(p models.PromoCode) bool { return p.Code == "HEMAT20" && !p.Active })).
+		Return(models.PromoCode{ID: 1, Code: "HEMAT20"}, nil)
+	repo.On("Delete", 9).Return(repositories.ErrPromoCodeNotFound)
+	handler := handlers.NewPromoHandler(services.NewPromoService(repo))
+
+	routes := []struct {
+		method, path, body string
+		want               int
+	}{
+		{http.MethodPost, "/api/promo-codes", `{"code": " hemat10 ", "discount": {"type": "percentage", "value": 10}}`, http.StatusCreated},
+		{http.MethodPost, "/api/promo-codes", `{"code": "lama", "discount": {"type": "fixed", "value": 5000}}`, http.StatusConflict},
+		{http.MethodPost, "/api/promo-codes", `{"code": "x", "discount": {"type": "fixed", "value": 0}}`, http.StatusBadRequest},
+		{http.MethodPost, "/api/promo-codes", `{"code": "x", "discount": {"type": "fixed", "value": 1}, "starts_at": "2026-02-01T00:00:00Z", "ends_at": "2026-01-01T00:00:00Z"}`, http.StatusBadRequest},
+		{http.MethodPut, "/api/promo-codes/1", `{"code": "hemat10", "discount": {"type": "percentage", "value": 10}}`, http.StatusOK},
+		{http.MethodPut, "/api/promo-codes/1", `{"code": "hemat20", "discount": {"type": "percentage", "value": 20}, "active": false}`, http.StatusOK},
+		{http.MethodDelete, "/api/promo-codes/9", "", http.StatusNotFound},
+		{http.MethodGet, "/api/promo-codes/abc", "", http.StatusBadRequest},
+	}
+	for _, tt := range routes {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+		if rr.Code != tt.want {
+			t.Errorf("%s %s %s: got status %d, want %d", tt.method, tt.path, tt.body, rr.Code, tt.want)
+		}
+	}
+	repo.AssertExpectations(t)
+}
+
+type MockTaxRepository struct {
+	mock.Mock
+}
+
+func (m *MockTaxRepository) GetAll() ([]models.TaxRate, error) {
+	args := m.Called()
+	return args.Get(0).([]models.TaxRate), args.Error(1)
+}
+
+func (m *MockTaxRepository) GetByID(id int) (models.TaxRate, error) {
+	args := m.Called(id)
+	return args.Get(0).(models.TaxRate), args.Error(1)
+}
+
+func (m *MockTaxRepository) Create(t models.TaxRate) (models.TaxRate, error) {
+	args := m.Called(t)
+	return args.Get(0).(models.TaxRate), args.Error(1)
+}
+
+func (m *MockTaxRepository) Update(id int, t models.TaxRate) (models.TaxRate, error) {
+	args := m.Called(id, t)
+	return args.Get(0).(models.TaxRate), args.Error(1)
+}
+
+func (m *MockTaxRepository) Delete(id int) error {
+	return m.Called(id).Error(0)
+}
+
+func TestTaxRates(t *testing.T) {
+	taxes := []struct {
+		rate   models.TaxRate
+		amount int
+		want   int
+	}{
+		{models.TaxRate{Rate: 11}, 15000, 1650},
+		{models.TaxRate{Rate: 11, Inclusive: true}, 11100, 1100},
+		{models.TaxRate{Rate: 11, Inclusive: true}, 15000, 1486},
+		{models.TaxRate{Rate: 2.5}, 999, 25},
+		{models.TaxRate{Rate: 0}, 15000, 0},
+	}
+	for _, tt := range taxes {
+		if got := tt.rate.Tax(tt.amount); got != tt.want {
+			t.Errorf("%+v.Tax(%d) = %d, want %d", tt.rate, tt.amount, got, tt.want)
+		}
+	}
+
+	lines := []struct {
+		rate     models.TaxRate
+		subtotal int
+		tax      int
+		total    int
+	}{
+		{models.TaxRate{ID: 1, Name: "PPN", Rate: 11}, 13500, 1485, 14985},
+		{models.TaxRate{ID: 2, Name: "PPN", Rate: 11, Inclusive: true}, 13500, 1338, 13500},
+	}
+	for _, tt := range lines {
+		d := models.TransactionDetail{Subtotal: tt.subtotal}
+		d.SetTax(tt.rate)
+		if d.TaxAmount != tt.tax || d.Total != tt.total || d.TaxRateID != tt.rate.ID || d.TaxInclusive != tt.rate.Inclusive {
+			t.Errorf("SetTax(%+v) on %d: got tax %d, total %d", tt.rate, tt.subtotal, d.TaxAmount, d.Total)
+		}
+	}
+
+	// A line of 3 units, 10001 charged of which 991 tax, refunded in parts
+	for _, parts := range [][]int{{1, 1, 1}, {2, 1}, {1, 2}, {3}} {
+		var units, amount, tax int
+		for _, quantity := range parts {
+			share := models.RefundShare(10001, 3, units, amount, quantity)
+			shareTax := models.RefundShare(991, 3, units, tax, quantity)
+			if units+quantity < 3 && (share != 10001*quantity/3 || shareTax != 991*quantity/3) {
+				t.Errorf("refunds %v: %d units after %d got %d with tax %d", parts, quantity, units, share, shareTax)
+			}
+			amount += share
+			tax += shareTax
+			units += quantity
+		}
+		if amount != 10001 || tax != 991 {
+			t.Errorf("refunds %v: refunded %d with tax %d, want 10001 with tax 991", parts, amount, tax)
+		}
+	}
+
+	repo := new(MockTaxRepository)
+	repo.On("Create", models.TaxRate{Name: "PPN", Rate: 11.11, Inclusive: true, Default: true}).
+		Return(models.TaxRate{ID: 1, Name: "PPN", Rate: 11.11, Inclusive: true, Default: true}, nil)
+	repo.On("Create", mock.MatchedBy(func(r models.TaxRate) bool { return r.Name == "ppn" })).
+		Return(models.TaxRate{}, repositories.ErrDuplicate)
+	repo.On("Update", 9, mock.Anything).Return(models.TaxRate{}, repositories.ErrTaxRateNotFound)
+	handler := handlers.NewTaxHandler(services.NewTaxService(repo))
+
+	routes := []struct {
+		method, path, body string
+		want               int
+	}{
+		{http.MethodPost, "/api/tax-rates", `{"name": " PPN ", "rate": 11.111, "inclusive": true, "is_default": true}`, http.StatusCreated},
+		{http.MethodPost, "/api/tax-rates", `{"name": "ppn", "rate": 11}`, http.StatusConflict},
+		{http.MethodPost, "/api/tax-rates", `{"name": "PPh", "rate": 120}`, http.StatusBadRequest},
+		{http.MethodPost, "/api/tax-rates", `{"rate": 11}`, http.StatusBadRequest},
+		{http.MethodPut, "/api/tax-rates/9", `{"name": "PPN", "rate": 12}`, http.StatusNotFound},
+		{http.MethodPatch, "/api/tax-rates/9", "", http.StatusMethodNotAllowed},
+	}
+	for _, tt := range routes {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+		if rr.Code != tt.want {
+			t.Errorf("%s %s %s: got status %d, want %d", tt.method, tt.path, tt.body, rr.Code, tt.want)
+		}
+	}
+	repo.AssertExpectations(t)
+
+	categories := new(MockCategoryRepository)
+	categories.On("Create", mock.Anything).
+		Return(models.Category{}, repositories.ErrForeignKeyViolation.WithDetails(map[string]string{"constraint": "categories_tax_rate_id_fkey"}))
+	_, err := services.NewCategoryService(categories, nil).Create(models.Category{Name: "Rokok", Slug: "rokok", TaxRateID: 99})
+	if !errors.Is(err, services.ErrInvalidTaxRate) {
+		t.Errorf("unknown tax rate: got %v, want %v", err, services.ErrInvalidTaxRate)
+	}
+}
+
+// MockProductRepository backs the product service in tests of its own logic.
+type MockProductRepository struct {
+	mock.Mock
+}
+
+func (m *MockProductRepository) GetAll(filter models.ProductFilter) ([]models.Produk, int, error) {
+	args := m.Called(filter)
+	return args.Get(0).([]models.Produk), args.Int(1), args.Error(2)
+}
+
+func (m *MockProductRepository) Each(filter models.ProductFilter, fn func(models.Produk) error) error {
+	args := m.Called(filter)
+	for _, p := range args.Get(0).([]models.Produk) {
+		if err := fn(p); err != nil {
+			return err
+		}
+	}
+	return args.Error(1)
+}
+
+func (m *MockProductRepository) GetByID(id int) (models.Produk, error) {
+	args := m.Called(id)
+	return args.Get(0).(models.Produk), args.Error(1)
+}
+
+func (m *MockProductRepository) GetByIDIncludingDeleted(id int) (models.Produk, error) {
+	args := m.Called(id)
+	return args.Get(0).(models.Produk), args.Error(1)
+}
+
+func (m *MockProductRepository) GetByBarcode(code string) (models.Produk, error) {
+	args := m.Called(code)
+	return args.Get(0).(models.Produk), args.Error(1)
+}
+
+func (m *MockProductRepository) Create(p models.Produk, actor string) (models.Produk, error) {
+	args := m.Called(p, actor)
+	return args.Get(0).(models.Produk), args.Error(1)
+}
+
+func (m *MockProductRepository) Update(id int, p models.Produk) (models.Produk, error) {
+	args := m.Called(id, p)
+	return args.Get(0).(models.Produk), args.Error(1)
+}
+
+func (m *MockProductRepository) Delete(id int) error {
+	return m.Called(id).Error(0)
+}
+
+func (m *MockProductRepository) Restore(id int) (models.Produk, error) {
+	args := m.Called(id)
+	return args.Get(0).(models.Produk), args.Error(1)
+}
+
+func (m *MockProductRepository) GetIDsBySKU(skus []string) (map[string]int, error) {
+	args := m.Called(skus)
+	ids, _ := args.Get(0).(map[string]int)
+	return ids, args.Error(1)
+}
+
+func (m *MockProductRepository) GetIDsByBarcode(codes []string) (map[string]int, error) {
+	args := m.Called(codes)
+	ids, _ := args.Get(0).(map[string]int)
+	return ids, args.Error(1)
+}
+
+func (m *MockProductRepository) GetLowStock(categoryID string) ([]models.LowStockItem, error) {
+	args := m.Called(categoryID)
+	return args.Get(0).([]models.LowStockItem), args.Error(1)
+}
+
+func (m *MockProductRepository) Import(rows []models.ImportRow, actor string) (int, int, error) {
+	args := m.Called(rows, actor)
+	return args.Int(0), args.Int(1), args.Error(2)
+}
+
+func TestProductRestoreAndCodeConflicts(t *testing.T) {
+	deletedAt := time.Now()
+	repo := new(MockProductRepository)
+	repo.On("GetByIDIncludingDeleted", 3).Return(models.Produk{ID: 3, SKU: "KOPI-1", DeletedAt: &deletedAt}, nil)
+	repo.On("GetByIDIncludingDeleted", 4).Return(models.Produk{ID: 4, Barcodes: []string{"899001"}}, nil)
+	repo.On("GetByIDIncludingDeleted", 5).Return(models.Produk{ID: 5, CategoryID: "kopi", DeletedAt: &deletedAt}, nil)
+	repo.On("Create", mock.MatchedBy(func(p models.Produk) bool { return p.SKU == "KOPI-1" }), "kasir").
+		Return(models.Produk{}, repositories.ErrDuplicate.WithDetails(map[string]string{"constraint": "products_sku_key"}))
+	repo.On("Create", mock.MatchedBy(func(p models.Produk) bool { return p.SKU == "" }), "kasir").
+		Return(models.Produk{}, repositories.ErrDuplicate.WithDetails(map[string]string{"constraint": "product_barcodes_pkey"}))
+	repo.On("GetIDsBySKU", []string{"KOPI-1"}).Return(map[string]int{"KOPI-1": 3}, nil)
+	repo.On("GetIDsByBarcode", []string{"899001"}).Return(map[string]int{"899001": 4}, nil)
+	categories := new(MockCategoryRepository)
+	categories.On("GetByID", "kopi").Return(models.Category{}, repositories.ErrCategoryNotFound)
+	service := services.NewProductService(repo, categories, nil, nil)
+
+	_, err := service.Create(models.Produk{Nama: "Kopi", Harga: 15000, SKU: "KOPI-1"}, "kasir")
+	if !errors.Is(err, services.ErrSKUTaken) || !strings.Contains(apperrors.From(err).Message, "deleted product 3") {
+		t.Errorf("sku of a deleted product: got %v", err)
+	}
+	_, err = service.Create(models.Produk{Nama: "Teh", Harga: 5000, Barcodes: []string{"899001"}}, "kasir")
+	if !errors.Is(err, services.ErrBarcodeTaken) || !strings.Contains(apperrors.From(err).Message, "used by product 4") {
+		t.Errorf("barcode of a live product: got %v", err)
+	}
+	if _, err := service.Restore(5); !errors.Is(err, services.ErrInvalidCategory) {
+		t.Errorf("restore into a deleted category: got %v", err)
+	}
+	repo.AssertNotCalled(t, "Restore", 5)
+}
+
+func TestUpdateProdukRejectsStockChanges(t *testing.T) {
+	repo := new(MockProductRepository)
+	repo.On("GetByID", 1).Return(models.Produk{ID: 1, Nama: "Kopi", Harga: 15000, Stok: 8}, nil)
+	repo.On("Update", 1, mock.Anything).Return(models.Produk{ID: 1, Nama: "Kopi", Harga: 16000, Stok: 8}, nil)
+	service := services.NewProductService(repo, nil, nil, nil)
+
+	zero, same := 0, 8
+	updates := []struct {
+		stok *int
+		want error
+	}{
+		{nil, nil},
+		{&same, nil},
+		{&zero, services.ErrStockNotEditable},
+	}
+	for _, tt := range updates {
+		u := models.ProdukUpdate{Produk: models.Produk{Nama: "Kopi", Harga: 16000}, Stok: tt.stok}
+		if _, err := service.Update(1, u); !errors.Is(err, tt.want) {
+			t.Errorf("Update with stok %v: got %v, want %v", tt.stok, err, tt.want)
+		}
+	}
+	repo.AssertNumberOfCalls(t, "Update", 2)
+}
+
+func TestImportProdukUpdatesOnlyGivenFields(t *testing.T) {
+	repo := new(MockProductRepository)
+	repo.On("GetIDsBySKU", []string{"KOPI-1"}).Return(map[string]int{"KOPI-1": 3}, nil)
+	repo.On("Import", mock.Anything, "kasir").Return(0, 1, nil)
+	service := services.NewProductService(repo, nil, nil, nil)
+
+	files := []struct {
+		format string
+		body   string
+	}{
+		{services.ImportFormatCSV, "sku,nama,harga\nKOPI-1,Kopi,16000\n"},
+		{services.ImportFormatJSON, `[{"sku": "KOPI-1", "nama": "Kopi", "harga": 16000}]`},
+	}
+	for _, tt := range files {
+		result, err := service.Import(strings.NewReader(tt.body), tt.format, false, "kasir")
+		if err != nil || result.Updated != 1 {
+			t.Fatalf("%s import: got %+v, err %v", tt.format, result, err)
+		}
+		calls := repo.Calls
+		rows := calls[len(calls)-1].Arguments.Get(0).([]models.ImportRow)
+		row := rows[0]
+		if row.Produk.Harga != 16000 || !row.Has("nama") || !row.Has("harga") {
+			t.Errorf("%s import: got row %+v", tt.format, row)
+		}
+		for _, field := range []string{"harga_pokok", "stok", "reorder_point", "category_id", "barcodes"} {
+			if row.Has(field) {
+				t.Errorf("%s import: row gives %s, want it left out", tt.format, field)
+			}
+		}
+	}
+}
+
+type MockTransactionRepository struct {
+	mock.Mock
+}
+
+func (m *MockTransactionRepository) CreateTransaction(req models.CheckoutRequest, idempotencyKey string) (models.CheckoutResponse, []models.LowStockItem, error) {
+	args := m.Called(req, idempotencyKey)
+	lowStock, _ := args.Get(1).([]models.LowStockItem)
+	return args.Get(0).(models.CheckoutResponse), lowStock, args.Error(2)
+}
+
+func (m *MockTransactionRepository) List(filter models.TransactionFilter) ([]models.Transaction, error) {
+	args := m.Called(filter)
+	return args.Get(0).([]models.Transaction), args.Error(1)
+}
+
+func (m *MockTransactionRepository) Each(filter models.TransactionFilter, fn func(models.Transaction) error) error {
+	return m.Called(filter).Error(0)
+}
+
+func (m *MockTransactionRepository) GetByID(id int) (models.Transaction, []models.TransactionDetail, error) {
+	args := m.Called(id)
+	return args.Get(0).(models.Transaction), args.Get(1).([]models.TransactionDetail), args.Error(2)
+}
+
+func (m *MockTransactionRepository) GetDiscounts(transactionID int) ([]models.AppliedDiscount, error) {
+	args := m.Called(transactionID)
+	return args.Get(0).([]models.AppliedDiscount), args.Error(1)
+}
+
+func (m *MockTransactionRepository) GetRevenue(start, end time.Time) (int, error) {
+	args := m.Called(start, end)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockTransactionRepository) GetTransactionCount(start, end time.Time) (int, error) {
+	args := m.Called(start, end)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockTransactionRepository) GetBestSellingProduct(start, end time.Time) (models.BestSellingProduct, error) {
+	args := m.Called(start, end)
+	return args.Get(0).(models.BestSellingProduct), args.Error(1)
+}
+
+func (m *MockTransactionRepository) GetDailySales(start, end time.Time, timezone string, cutoffHour int) ([]models.DailySales, error) {
+	args := m.Called(start, end, timezone, cutoffHour)
+	return args.Get(0).([]models.DailySales), args.Error(1)
+}
+
+func (m *MockTransactionRepository) GetGrossProfit(start, end time.Time) (models.GrossProfitReport, error) {
+	args := m.Called(start, end)
+	return args.Get(0).(models.GrossProfitReport), args.Error(1)
+}
+
+func (m *MockTransactionRepository) GetSalesBreakdown(start, end time.Time) (models.SalesBreakdown, error) {
+	args := m.Called(start, end)
+	return args.Get(0).(models.SalesBreakdown), args.Error(1)
+}
+
+func (m *MockTransactionRepository) GetTaxSummary(start, end time.Time) (models.TaxReport, error) {
+	args := m.Called(start, end)
+	return args.Get(0).(models.TaxReport), args.Error(1)
+}
+
+type MockIdempotencyRepository struct {
+	mock.Mock
+}
+
+func (m *MockIdempotencyRepository) Reserve(key string, requestHash string, expiresAt time.Time) (models.IdempotencyKey, bool, error) {
+	args := m.Called(key, requestHash)
+	return args.Get(0).(models.IdempotencyKey), args.Bool(1), args.Error(2)
+}
+
+func (m *MockIdempotencyRepository) Release(key string) error {
+	return m.Called(key).Error(0)
+}
+
+func (m *MockIdempotencyRepository) DeleteExpired() (int64, error) {
+	args := m.Called()
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func TestCheckoutIdempotentStoresResponseWithSale(t *testing.T) {
+	sale := models.CheckoutResponse{Transaction: models.Transaction{ID: 9, PromoCode: "HEMAT"}}
+	transactions := new(MockTransactionRepository)
+	transactions.On("CreateTransaction", mock.MatchedBy(func(req models.CheckoutRequest) bool { return req.PromoCode == "HEMAT" }), "retry-1").
+		Return(sale, nil, nil)
+	var hash string
+	keys := new(MockIdempotencyRepository)
+	keys.On("Reserve", "retry-1", mock.Anything).Return(models.IdempotencyKey{}, true, nil).Once().
+		Run(func(args mock.Arguments) { hash = args.String(1) })
+	service := services.NewTransactionService(transactions, nil, keys, time.Hour, services.BusinessDay{}, nil)
+
+	items := []models.CheckoutItem{{ProductID: 1, Quantity: 2}}
+	response, replayed, err := service.CheckoutIdempotent("retry-1", models.CheckoutRequest{Items: items, PromoCode: " HEMAT"})
+	if err != nil || replayed || response.Transaction.ID != 9 {
+		t.Fatalf("first checkout: got %+v, replayed %v, err %v", response, replayed, err)
+	}
+
+	// The retry trims to the same request and replays what the sale stored
+	stored, _ := json.Marshal(sale)
+	keys.On("Reserve", "retry-1", mock.Anything).Return(models.IdempotencyKey{Key: "retry-1", RequestHash: hash, StatusCode: 201, Response: stored}, false, nil)
+	response, replayed, err = service.CheckoutIdempotent("retry-1", models.CheckoutRequest{Items: items, PromoCode: "HEMAT"})
+	if err != nil || !replayed || response.Transaction.ID != 9 {
+		t.Errorf("retry: got %+v, replayed %v, err %v", response, replayed, err)
+	}
+	transactions.AssertNumberOfCalls(t, "CreateTransaction", 1)
+	keys.AssertNotCalled(t, "Release", "retry-1")
+}
+
+type MockReversalRepository struct {
+	mock.Mock
+}
+
+func (m *MockReversalRepository) Void(transactionID int, req models.VoidRequest) (models.Reversal, error) {
+	args := m.Called(transactionID, req)
+	return args.Get(0).(models.Reversal), args.Error(1)
+}
+
+func (m *MockReversalRepository) Refund(transactionID int, req models.RefundRequest) (models.Reversal, error) {
+	args := m.Called(transactionID, req)
+	return args.Get(0).(models.Reversal), args.Error(1)
+}
+
+func (m *MockReversalRepository) GetByTransactionID(transactionID int) ([]models.Reversal, error) {
+	args := m.Called(transactionID)
+	reversals, _ := args.Get(0).([]models.Reversal)
+	return reversals, args.Error(1)
+}
+
+func TestTransactionDetailKeepsSaleSnapshot(t *testing.T) {
+	// Product 1 has since been renamed and repriced; its line keeps what it
+	// was sold as
+	line := models.TransactionDetail{ID: 11, TransactionID: 9, ProductID: 1, ProductName: "Kopi Susu",
+		UnitPrice: 15000, UnitCost: 9000, Quantity: 2, Discount: 3000, Subtotal: 27000, Total: 27000}
+	transactions := new(MockTransactionRepository)
+	transactions.On("GetByID", 9).Return(models.Transaction{ID: 9, TotalAmount: 27000}, []models.TransactionDetail{line}, nil)
+	transactions.On("GetDiscounts", 9).Return([]models.AppliedDiscount{}, nil)
+	reversals := new(MockReversalRepository)
+	reversals.On("GetByTransactionID", 9).Return(nil, nil)
+	service := services.NewTransactionService(transactions, reversals, nil, time.Hour, services.BusinessDay{}, nil)
+	handler := handlers.NewTransactionHandler(service)
+
+	req, _ := http.NewRequest("GET", "/api/transactions/9", nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var body struct {
+		Details []map[string]interface{} `json:"details"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil || len(body.Details) != 1 {
+		t.Fatalf("got %s, err %v", rr.Body.String(), err)
+	}
+	want := map[string]interface{}{"product_name": "Kopi Susu", "unit_price": 15000.0, "unit_cost": 9000.0, "discount": 3000.0, "subtotal": 27000.0}
+	for field, value := range want {
+		if got := body.Details[0][field]; got != value {
+			t.Errorf("%s: got %v, want %v", field, got, value)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"category-api/database"
+	"category-api/repositories"
+	"category-api/services"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+)
+
+const usage = `usage:
+  main                      start the HTTP server
+  main migrate up           apply all pending migrations
+  main migrate down         roll back the latest migration
+  main migrate status       list migrations and whether they are applied
+  main import-products [-dry-run] [-actor name] <file.csv|file.json>
+                            upsert products by SKU from a CSV or JSON file
+  main seed [-dry-run] [categories.json]
+                            upsert categories by ID from a seed file`
+
+// runCommand dispatches the command line sub-commands.
+func runCommand(db *sql.DB, args []string) error {
+	switch args[0] {
+	case "migrate":
+		if len(args) != 2 {
+			return fmt.Errorf("%s", usage)
+		}
+		return runMigrate(db, args[1])
+	case "import-products":
+		return runImportProducts(db, args[1:])
+	case "seed":
+		return runSeed(db, args[1:])
+	default:
+		return fmt.Errorf("unknown command %q\n%s", args[0], usage)
+	}
+}
+
+func runMigrate(db *sql.DB, action string) error {
+	switch action {
+	case "up":
+		return migrateUp(db)
+	case "down":
+		migrator, err := database.NewMigrator(db)
+		if err != nil {
+			return err
+		}
+		mig, err := migrator.Down()
+		if err != nil {
+			return err
+		}
+		if mig == nil {
+			log.Println("No migrations to roll back")
+			return nil
+		}
+		log.Printf("Rolled back migration %04d_%s", mig.Version, mig.Name)
+		return nil
+	case "status":
+		migrator, err := database.NewMigrator(db)
+		if err != nil {
+			return err
+		}
+		statuses, err := migrator.Status()
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "VERSION\tNAME\tSTATUS")
+		for _, st := range statuses {
+			state := "pending"
+			if st.Applied {
+				state = "applied " + st.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(tw, "%04d\t%s\t%s\n", st.Version, st.Name, state)
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown migrate action %q\n%s", action, usage)
+	}
+}
+
+func migrateUp(db *sql.DB) error {
+	migrator, err := database.NewMigrator(db)
+	if err != nil {
+		return err
+	}
+	applied, err := migrator.Up()
+	if err != nil {
+		return err
+	}
+	for _, mig := range applied {
+		log.Printf("Applied migration %04d_%s", mig.Version, mig.Name)
+	}
+	log.Println("Database schema is up to date")
+	return nil
+}
+
+// runImportProducts loads a product file through the same validation and
+// transactional upsert as POST /api/produk/import.
+func runImportProducts(db *sql.DB, args []string) error {
+	fs := flag.NewFlagSet("import-products", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "validate the file without writing")
+	actor := fs.String("actor", "import-products", "name recorded with the stock movements of the import")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("%s", usage)
+	}
+	path := fs.Arg(0)
+
+	format := strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	productService := services.NewProductService(
+		repositories.NewProductRepository(db),
+		repositories.NewCategoryRepository(db),
+		repositories.NewVariantRepository(db),
+		repositories.NewStockRepository(db),
+	)
+	result, err := productService.Import(f, format, *dryRun, *actor)
+	for _, rowErr := range result.Errors {
+		log.Printf("%s:%d: %s", path, rowErr.Line, rowErr.Message)
+	}
+	if err != nil {
+		return err
+	}
+	if len(result.Errors) > 0 {
+		return fmt.Errorf("%s has %d invalid rows", path, len(result.Errors))
+	}
+
+	verb := "Imported"
+	if result.DryRun {
+		verb = "Dry run: would import"
+	}
+	log.Printf("%s %d products (%d created, %d updated)", verb, result.Total, result.Created, result.Updated)
+	return nil
+}
+
+// runSeed loads a category seed file, categories.json by default, through
+// the same validation and transactional upsert as POST /api/categories/import.
+func runSeed(db *sql.DB, args []string) error {
+	fs := flag.NewFlagSet("seed", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "validate the file without writing")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 1 {
+		return fmt.Errorf("%s", usage)
+	}
+	path := "categories.json"
+	if fs.NArg() == 1 {
+		path = fs.Arg(0)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	categoryService := services.NewCategoryService(repositories.NewCategoryRepository(db), repositories.NewProductRepository(db))
+	result, err := categoryService.Import(f, *dryRun)
+	for _, catErr := range result.Errors {
+		log.Printf("%s: category %s: %s", path, catErr.ID, catErr.Message)
+	}
+	if err != nil {
+		return err
+	}
+	if len(result.Errors) > 0 {
+		return fmt.Errorf("%s has %d invalid categories", path, len(result.Errors))
+	}
+
+	verb := "Seeded"
+	if result.DryRun {
+		verb = "Dry run: would seed"
+	}
+	log.Printf("%s %d categories (%d created, %d updated)", verb, result.Total, result.Created, result.Updated)
+	return nil
+}
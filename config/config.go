@@ -3,13 +3,33 @@ package config
 import (
 	"log"
 	"os"
+	"time"
 
 	"github.com/spf13/viper"
 )
 
 type Config struct {
-	DBConn  string `mapstructure:"DB_CONN"`
-	AppPort string `mapstructure:"APP_PORT"`
+	DBConn      string `mapstructure:"DB_CONN"`
+	AppPort     string `mapstructure:"APP_PORT"`
+	AutoMigrate bool   `mapstructure:"AUTO_MIGRATE"`
+
+	// How long checkout Idempotency-Key values are remembered
+	IdempotencyTTL time.Duration `mapstructure:"IDEMPOTENCY_TTL"`
+
+	// Store timezone (IANA name) and the hour at which a business day starts,
+	// e.g. 4 for shops whose sales until 04:00 belong to the previous day
+	StoreTimezone         string         `mapstructure:"STORE_TIMEZONE"`
+	BusinessDayCutoffHour int            `mapstructure:"BUSINESS_DAY_CUTOFF_HOUR"`
+	StoreLocation         *time.Location `mapstructure:"-"`
+
+	// Channels low-stock alerts are delivered through: log, webhook and/or
+	// email, comma separated. Email goes through the SMTP relay at SMTPAddr.
+	Notifiers      []string      `mapstructure:"NOTIFIERS"`
+	AlertWebhook   string        `mapstructure:"ALERT_WEBHOOK_URL"`
+	WebhookTimeout time.Duration `mapstructure:"ALERT_WEBHOOK_TIMEOUT"`
+	SMTPAddr       string        `mapstructure:"SMTP_ADDR"`
+	AlertEmailFrom string        `mapstructure:"ALERT_EMAIL_FROM"`
+	AlertEmailTo   []string      `mapstructure:"ALERT_EMAIL_TO"`
 }
 
 func LoadConfig() *Config {
@@ -24,6 +44,25 @@ func LoadConfig() *Config {
 	_ = viper.BindEnv("DB_CONN")
 	_ = viper.BindEnv("APP_PORT")
 	_ = viper.BindEnv("PORT") // For Render
+	_ = viper.BindEnv("AUTO_MIGRATE")
+	_ = viper.BindEnv("IDEMPOTENCY_TTL")
+	_ = viper.BindEnv("STORE_TIMEZONE")
+	_ = viper.BindEnv("BUSINESS_DAY_CUTOFF_HOUR")
+	_ = viper.BindEnv("NOTIFIERS")
+	_ = viper.BindEnv("ALERT_WEBHOOK_URL")
+	_ = viper.BindEnv("ALERT_WEBHOOK_TIMEOUT")
+	_ = viper.BindEnv("SMTP_ADDR")
+	_ = viper.BindEnv("ALERT_EMAIL_FROM")
+	_ = viper.BindEnv("ALERT_EMAIL_TO")
+
+	// Apply pending migrations on server start unless disabled
+	viper.SetDefault("AUTO_MIGRATE", true)
+	viper.SetDefault("IDEMPOTENCY_TTL", "24h")
+	viper.SetDefault("STORE_TIMEZONE", "Asia/Jakarta")
+	viper.SetDefault("BUSINESS_DAY_CUTOFF_HOUR", 0)
+	viper.SetDefault("NOTIFIERS", "log")
+	viper.SetDefault("ALERT_WEBHOOK_TIMEOUT", "10s")
+	viper.SetDefault("SMTP_ADDR", "localhost:25")
 
 	var config Config
 	if err := viper.Unmarshal(&config); err != nil {
@@ -40,5 +79,15 @@ func LoadConfig() *Config {
 		config.AppPort = "8080"
 	}
 
+	location, err := time.LoadLocation(config.StoreTimezone)
+	if err != nil {
+		log.Fatalf("Invalid STORE_TIMEZONE %q: %v", config.StoreTimezone, err)
+	}
+	config.StoreLocation = location
+
+	if config.BusinessDayCutoffHour < 0 || config.BusinessDayCutoffHour > 23 {
+		log.Fatalf("BUSINESS_DAY_CUTOFF_HOUR must be between 0 and 23, got %d", config.BusinessDayCutoffHour)
+	}
+
 	return &config
 }
@@ -0,0 +1,35 @@
+-- Core catalog and checkout schema. Statements are idempotent so databases
+-- created by the old createTables bootstrap can adopt the migration history.
+CREATE TABLE IF NOT EXISTS categories (
+	id VARCHAR(50) PRIMARY KEY,
+	name VARCHAR(100) NOT NULL,
+	description TEXT
+);
+
+CREATE TABLE IF NOT EXISTS products (
+	id SERIAL PRIMARY KEY,
+	nama VARCHAR(100) NOT NULL,
+	harga INT NOT NULL,
+	stok INT NOT NULL
+);
+
+ALTER TABLE products ADD COLUMN IF NOT EXISTS category_id VARCHAR(50) REFERENCES categories(id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS idx_products_category_id ON products (category_id);
+
+CREATE TABLE IF NOT EXISTS transactions (
+	id SERIAL PRIMARY KEY,
+	total_amount INT NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_transactions_created_at ON transactions (created_at);
+
+CREATE TABLE IF NOT EXISTS transaction_details (
+	id SERIAL PRIMARY KEY,
+	transaction_id INT NOT NULL REFERENCES transactions(id) ON DELETE CASCADE,
+	product_id INT NOT NULL REFERENCES products(id),
+	quantity INT NOT NULL,
+	subtotal INT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_transaction_details_transaction_id ON transaction_details (transaction_id);
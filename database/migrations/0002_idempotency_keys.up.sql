@@ -0,0 +1,12 @@
+-- Idempotency keys let POS clients safely retry POST /api/checkout.
+-- status_code and response stay NULL while the original request is in flight.
+CREATE TABLE idempotency_keys (
+	key VARCHAR(255) PRIMARY KEY,
+	request_hash CHAR(64) NOT NULL,
+	status_code INT,
+	response JSONB,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_idempotency_keys_expires_at ON idempotency_keys (expires_at);
@@ -0,0 +1,15 @@
+DROP INDEX IF EXISTS idx_transaction_details_product_id;
+
+-- Lines of deleted products cannot point anywhere once the FK is strict again
+DELETE FROM transaction_details WHERE product_id IS NULL;
+
+ALTER TABLE transaction_details
+	DROP CONSTRAINT IF EXISTS transaction_details_product_id_fkey,
+	ADD CONSTRAINT transaction_details_product_id_fkey
+		FOREIGN KEY (product_id) REFERENCES products(id),
+	ALTER COLUMN product_id SET NOT NULL;
+
+ALTER TABLE transaction_details
+	DROP COLUMN discount,
+	DROP COLUMN unit_price,
+	DROP COLUMN product_name;
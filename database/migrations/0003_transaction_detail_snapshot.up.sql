@@ -0,0 +1,28 @@
+-- Snapshot what was sold on every line so renaming, repricing or deleting a
+-- product no longer rewrites historic receipts and reports.
+ALTER TABLE transaction_details
+	ADD COLUMN product_name VARCHAR(100),
+	ADD COLUMN unit_price INT,
+	ADD COLUMN discount INT NOT NULL DEFAULT 0;
+
+UPDATE transaction_details td
+SET product_name = p.nama
+FROM products p
+WHERE p.id = td.product_id;
+
+UPDATE transaction_details
+SET product_name = COALESCE(product_name, ''),
+	unit_price = CASE WHEN quantity > 0 THEN subtotal / quantity ELSE 0 END;
+
+ALTER TABLE transaction_details
+	ALTER COLUMN product_name SET NOT NULL,
+	ALTER COLUMN unit_price SET NOT NULL;
+
+-- History outlives the product it refers to
+ALTER TABLE transaction_details
+	ALTER COLUMN product_id DROP NOT NULL,
+	DROP CONSTRAINT IF EXISTS transaction_details_product_id_fkey,
+	ADD CONSTRAINT transaction_details_product_id_fkey
+		FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_transaction_details_product_id ON transaction_details (product_id);
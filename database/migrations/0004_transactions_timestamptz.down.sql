@@ -0,0 +1,3 @@
+ALTER TABLE transactions
+	ALTER COLUMN created_at TYPE TIMESTAMP USING created_at AT TIME ZONE current_setting('TimeZone'),
+	ALTER COLUMN created_at SET DEFAULT CURRENT_TIMESTAMP;
@@ -0,0 +1,6 @@
+-- Store sale instants with their offset so business days can be computed in
+-- the store timezone regardless of the server or session zone. Existing values
+-- were written by CURRENT_TIMESTAMP in the session zone, so read them as such.
+ALTER TABLE transactions
+	ALTER COLUMN created_at TYPE TIMESTAMPTZ USING created_at AT TIME ZONE current_setting('TimeZone'),
+	ALTER COLUMN created_at SET DEFAULT NOW();
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS transaction_reversal_items;
+DROP TABLE IF EXISTS transaction_reversals;
+ALTER TABLE transactions DROP COLUMN IF EXISTS status;
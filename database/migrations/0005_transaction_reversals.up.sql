@@ -0,0 +1,27 @@
+-- Voids cancel a whole sale, refunds return individual lines. Each reversal is
+-- a record linked to the original transaction; stock is restored alongside.
+ALTER TABLE transactions ADD COLUMN status VARCHAR(20) NOT NULL DEFAULT 'completed';
+
+CREATE TABLE transaction_reversals (
+	id SERIAL PRIMARY KEY,
+	transaction_id INT NOT NULL REFERENCES transactions(id) ON DELETE CASCADE,
+	type VARCHAR(10) NOT NULL CHECK (type IN ('void', 'refund')),
+	reason_code VARCHAR(30) NOT NULL,
+	note TEXT NOT NULL DEFAULT '',
+	amount INT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_transaction_reversals_transaction_id ON transaction_reversals (transaction_id);
+CREATE INDEX idx_transaction_reversals_created_at ON transaction_reversals (created_at);
+
+CREATE TABLE transaction_reversal_items (
+	id SERIAL PRIMARY KEY,
+	reversal_id INT NOT NULL REFERENCES transaction_reversals(id) ON DELETE CASCADE,
+	transaction_detail_id INT NOT NULL REFERENCES transaction_details(id) ON DELETE CASCADE,
+	quantity INT NOT NULL CHECK (quantity > 0),
+	amount INT NOT NULL
+);
+
+CREATE INDEX idx_transaction_reversal_items_reversal_id ON transaction_reversal_items (reversal_id);
+CREATE INDEX idx_transaction_reversal_items_detail_id ON transaction_reversal_items (transaction_detail_id);
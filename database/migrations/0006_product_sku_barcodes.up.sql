@@ -0,0 +1,9 @@
+-- Products get an optional unique SKU and any number of scannable barcodes.
+ALTER TABLE products ADD COLUMN sku VARCHAR(64) UNIQUE;
+
+CREATE TABLE product_barcodes (
+	code VARCHAR(64) PRIMARY KEY,
+	product_id INT NOT NULL REFERENCES products(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_product_barcodes_product_id ON product_barcodes (product_id);
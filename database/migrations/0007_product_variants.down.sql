@@ -0,0 +1,4 @@
+ALTER TABLE transaction_details DROP COLUMN IF EXISTS variant_name;
+ALTER TABLE transaction_details DROP COLUMN IF EXISTS variant_id;
+DROP TABLE IF EXISTS product_variants;
+ALTER TABLE products DROP COLUMN IF EXISTS option_axes;
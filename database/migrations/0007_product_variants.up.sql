@@ -0,0 +1,21 @@
+-- Variants sell a product in several option combinations (size, color, ...),
+-- each with its own SKU, price and stock. option_axes names the options every
+-- variant of the product must set.
+ALTER TABLE products ADD COLUMN option_axes TEXT[] NOT NULL DEFAULT '{}';
+
+CREATE TABLE product_variants (
+	id SERIAL PRIMARY KEY,
+	product_id INT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+	sku VARCHAR(64) UNIQUE,
+	options JSONB NOT NULL DEFAULT '{}',
+	harga INT NOT NULL CHECK (harga >= 0),
+	stok INT NOT NULL DEFAULT 0 CHECK (stok >= 0),
+	UNIQUE (product_id, options)
+);
+
+CREATE INDEX idx_product_variants_product_id ON product_variants (product_id);
+
+-- Sold variants are snapshotted like products: variant_name keeps the option
+-- values as sold, variant_id is cleared when the variant is deleted.
+ALTER TABLE transaction_details ADD COLUMN variant_id INT REFERENCES product_variants(id) ON DELETE SET NULL;
+ALTER TABLE transaction_details ADD COLUMN variant_name VARCHAR(255) NOT NULL DEFAULT '';
@@ -0,0 +1,8 @@
+-- Soft deleted rows become hard deletes when rolling back
+DELETE FROM products WHERE deleted_at IS NOT NULL;
+DELETE FROM categories WHERE deleted_at IS NOT NULL;
+
+DROP INDEX IF EXISTS idx_categories_active;
+DROP INDEX IF EXISTS idx_products_active;
+ALTER TABLE categories DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE products DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,7 @@
+-- Products and categories are soft deleted so sales history keeps its links
+-- and an accidental delete can be restored.
+ALTER TABLE products ADD COLUMN deleted_at TIMESTAMPTZ;
+ALTER TABLE categories ADD COLUMN deleted_at TIMESTAMPTZ;
+
+CREATE INDEX idx_products_active ON products (id) WHERE deleted_at IS NULL;
+CREATE INDEX idx_categories_active ON categories (id) WHERE deleted_at IS NULL;
@@ -0,0 +1,3 @@
+ALTER TABLE transaction_details DROP COLUMN IF EXISTS unit_cost;
+ALTER TABLE product_variants DROP COLUMN IF EXISTS harga_pokok;
+ALTER TABLE products DROP COLUMN IF EXISTS harga_pokok;
@@ -0,0 +1,5 @@
+-- Cost price (harga pokok) of products and variants, snapshotted on every
+-- sold line so gross profit reflects the cost at the time of sale.
+ALTER TABLE products ADD COLUMN harga_pokok INT NOT NULL DEFAULT 0 CHECK (harga_pokok >= 0);
+ALTER TABLE product_variants ADD COLUMN harga_pokok INT NOT NULL DEFAULT 0 CHECK (harga_pokok >= 0);
+ALTER TABLE transaction_details ADD COLUMN unit_cost INT NOT NULL DEFAULT 0;
@@ -0,0 +1,36 @@
+-- Every stock change is appended to stock_movements: quantity is the signed
+-- change and stok_after the balance of the product, or of the variant when
+-- variant_id is set, right after it. variant_id has no foreign key because
+-- variants are deleted outright while their history must stay.
+CREATE TABLE stock_movements (
+	id BIGSERIAL PRIMARY KEY,
+	product_id INT NOT NULL REFERENCES products(id),
+	variant_id INT,
+	type VARCHAR(20) NOT NULL CHECK (type IN ('initial', 'sale', 'refund', 'void', 'adjustment', 'receiving', 'transfer_in', 'transfer_out', 'import')),
+	quantity INT NOT NULL CHECK (quantity <> 0),
+	stok_after INT NOT NULL,
+	reason TEXT NOT NULL DEFAULT '',
+	reference VARCHAR(100) NOT NULL DEFAULT '',
+	actor VARCHAR(100) NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_stock_movements_product_id ON stock_movements (product_id, id);
+
+-- The ledger is append-only: corrections are new movements, never edits.
+CREATE FUNCTION stock_movements_append_only() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'stock_movements is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER stock_movements_append_only
+	BEFORE UPDATE OR DELETE ON stock_movements
+	FOR EACH ROW EXECUTE FUNCTION stock_movements_append_only();
+
+-- Open the ledger with the stock on hand so balances add up from the start
+INSERT INTO stock_movements (product_id, type, quantity, stok_after, reason)
+SELECT id, 'initial', stok, stok, 'opening balance' FROM products WHERE stok <> 0;
+
+INSERT INTO stock_movements (product_id, variant_id, type, quantity, stok_after, reason)
+SELECT product_id, id, 'initial', stok, stok, 'opening balance' FROM product_variants WHERE stok <> 0;
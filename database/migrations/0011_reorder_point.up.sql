@@ -0,0 +1,3 @@
+-- Reorder point: a product, or each of its variants, is low on stock once its
+-- stock is at or below it. 0 disables low-stock alerts for the product.
+ALTER TABLE products ADD COLUMN reorder_point INT NOT NULL DEFAULT 0 CHECK (reorder_point >= 0);
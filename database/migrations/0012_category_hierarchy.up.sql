@@ -0,0 +1,6 @@
+-- Categories nest under an optional parent, e.g. Minuman > Kopi > Kopi Susu.
+-- Cycles are prevented by the service; the check only rules out the trivial one.
+ALTER TABLE categories ADD COLUMN parent_id VARCHAR(50) REFERENCES categories(id) ON DELETE SET NULL;
+ALTER TABLE categories ADD CONSTRAINT categories_parent_not_self CHECK (parent_id <> id);
+
+CREATE INDEX idx_categories_parent_id ON categories (parent_id);
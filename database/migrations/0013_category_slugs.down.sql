@@ -0,0 +1,3 @@
+-- Duplicate category names renamed by the up migration keep their new names.
+ALTER TABLE categories DROP COLUMN IF EXISTS slug;
+DROP INDEX IF EXISTS categories_name_lower_key;
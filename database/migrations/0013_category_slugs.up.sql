@@ -0,0 +1,63 @@
+-- Category names are unique regardless of case among categories that are not
+-- deleted, and every category gets a unique URL slug. Existing duplicates
+-- are renamed first with the lowest numeric suffix that is not taken, the
+-- name shortened to keep within its column. The down migration does not
+-- restore the old names.
+DO $$
+DECLARE
+	dup RECORD;
+	n INT;
+	candidate VARCHAR(100);
+BEGIN
+	FOR dup IN
+		SELECT id, TRIM(name) AS name FROM (
+			SELECT id, name, ROW_NUMBER() OVER (PARTITION BY LOWER(TRIM(name)) ORDER BY id) AS n
+			FROM categories WHERE deleted_at IS NULL
+		) d
+		WHERE d.n > 1 ORDER BY id
+	LOOP
+		n := 2;
+		LOOP
+			candidate := RTRIM(LEFT(dup.name, 100 - LENGTH(' (' || n || ')'))) || ' (' || n || ')';
+			EXIT WHEN NOT EXISTS (
+				SELECT 1 FROM categories WHERE deleted_at IS NULL AND LOWER(TRIM(name)) = LOWER(candidate)
+			);
+			n := n + 1;
+		END LOOP;
+		UPDATE categories SET name = candidate WHERE id = dup.id;
+	END LOOP;
+END;
+$$;
+
+CREATE UNIQUE INDEX categories_name_lower_key ON categories (LOWER(name)) WHERE deleted_at IS NULL;
+
+ALTER TABLE categories ADD COLUMN slug VARCHAR(120);
+
+UPDATE categories SET slug = COALESCE(NULLIF(TRIM(BOTH '-' FROM LOWER(REGEXP_REPLACE(name, '[^a-zA-Z0-9]+', '-', 'g'))), ''), 'category');
+
+-- Repeated slugs get the lowest "-n" suffix no other slug has
+DO $$
+DECLARE
+	dup RECORD;
+	n INT;
+	candidate VARCHAR(120);
+BEGIN
+	FOR dup IN
+		SELECT id, slug FROM (
+			SELECT id, slug, ROW_NUMBER() OVER (PARTITION BY slug ORDER BY id) AS n FROM categories
+		) d
+		WHERE d.n > 1 ORDER BY id
+	LOOP
+		n := 2;
+		LOOP
+			candidate := LEFT(dup.slug, 120 - LENGTH('-' || n)) || '-' || n;
+			EXIT WHEN NOT EXISTS (SELECT 1 FROM categories WHERE slug = candidate);
+			n := n + 1;
+		END LOOP;
+		UPDATE categories SET slug = candidate WHERE id = dup.id;
+	END LOOP;
+END;
+$$;
+
+ALTER TABLE categories ALTER COLUMN slug SET NOT NULL;
+ALTER TABLE categories ADD CONSTRAINT categories_slug_key UNIQUE (slug);
@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS transaction_discounts;
+
+ALTER TABLE transactions
+	DROP COLUMN IF EXISTS promo_code,
+	DROP COLUMN IF EXISTS promo_code_id,
+	DROP COLUMN IF EXISTS discount_amount,
+	DROP COLUMN IF EXISTS gross_amount;
+
+DROP TABLE IF EXISTS promo_codes;
@@ -0,0 +1,50 @@
+-- Promo codes give a percentage or fixed discount off the cart, optionally
+-- only within a validity window, up to a number of uses and above a minimum
+-- spend. Codes are matched case-insensitively.
+CREATE TABLE promo_codes (
+	id SERIAL PRIMARY KEY,
+	code VARCHAR(50) NOT NULL,
+	description TEXT NOT NULL DEFAULT '',
+	discount_type VARCHAR(10) NOT NULL CHECK (discount_type IN ('percentage', 'fixed')),
+	discount_value INT NOT NULL CHECK (discount_value > 0),
+	min_spend INT NOT NULL DEFAULT 0 CHECK (min_spend >= 0),
+	starts_at TIMESTAMPTZ,
+	ends_at TIMESTAMPTZ,
+	usage_limit INT NOT NULL DEFAULT 0 CHECK (usage_limit >= 0),
+	used_count INT NOT NULL DEFAULT 0 CHECK (used_count >= 0),
+	active BOOLEAN NOT NULL DEFAULT TRUE,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	CHECK (discount_type <> 'percentage' OR discount_value <= 100),
+	CHECK (ends_at IS NULL OR starts_at IS NULL OR ends_at > starts_at)
+);
+
+CREATE UNIQUE INDEX promo_codes_code_key ON promo_codes (UPPER(code));
+
+-- total_amount stays what the customer paid; gross_amount is the undiscounted
+-- sum of the lines and discount_amount the difference. Existing sales had no
+-- discounts.
+ALTER TABLE transactions
+	ADD COLUMN gross_amount INT,
+	ADD COLUMN discount_amount INT NOT NULL DEFAULT 0,
+	ADD COLUMN promo_code_id INT REFERENCES promo_codes(id) ON DELETE SET NULL,
+	ADD COLUMN promo_code VARCHAR(50) NOT NULL DEFAULT '';
+
+UPDATE transactions SET gross_amount = total_amount;
+ALTER TABLE transactions ALTER COLUMN gross_amount SET NOT NULL;
+
+-- Every discount applied at checkout, against one line or the whole cart.
+-- Cart discounts are also spread over the lines' discount column so line
+-- subtotals keep adding up to the transaction total.
+CREATE TABLE transaction_discounts (
+	id SERIAL PRIMARY KEY,
+	transaction_id INT NOT NULL REFERENCES transactions(id) ON DELETE CASCADE,
+	transaction_detail_id INT REFERENCES transaction_details(id) ON DELETE CASCADE,
+	scope VARCHAR(10) NOT NULL CHECK (scope IN ('line', 'cart')),
+	promo_code_id INT REFERENCES promo_codes(id) ON DELETE SET NULL,
+	code VARCHAR(50) NOT NULL DEFAULT '',
+	discount_type VARCHAR(10) NOT NULL CHECK (discount_type IN ('percentage', 'fixed')),
+	discount_value INT NOT NULL,
+	amount INT NOT NULL CHECK (amount >= 0)
+);
+
+CREATE INDEX idx_transaction_discounts_transaction_id ON transaction_discounts (transaction_id);
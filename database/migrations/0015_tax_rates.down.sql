@@ -0,0 +1,15 @@
+ALTER TABLE transaction_reversal_items DROP COLUMN IF EXISTS tax_amount;
+ALTER TABLE transactions DROP COLUMN IF EXISTS tax_amount;
+
+ALTER TABLE transaction_details
+	DROP COLUMN IF EXISTS total,
+	DROP COLUMN IF EXISTS tax_amount,
+	DROP COLUMN IF EXISTS tax_inclusive,
+	DROP COLUMN IF EXISTS tax_rate,
+	DROP COLUMN IF EXISTS tax_name,
+	DROP COLUMN IF EXISTS tax_rate_id;
+
+ALTER TABLE categories DROP COLUMN IF EXISTS tax_rate_id;
+ALTER TABLE products DROP COLUMN IF EXISTS tax_rate_id;
+
+DROP TABLE IF EXISTS tax_rates;
@@ -0,0 +1,37 @@
+-- Tax rates such as PPN. Inclusive rates are already contained in the prices
+-- of the products they apply to; exclusive rates are added on top at
+-- checkout. A product is taxed at its own rate, else at the rate of its
+-- nearest category that has one, else at the default rate, if any.
+CREATE TABLE tax_rates (
+	id SERIAL PRIMARY KEY,
+	name VARCHAR(50) NOT NULL,
+	rate NUMERIC(5, 2) NOT NULL CHECK (rate >= 0 AND rate <= 100),
+	inclusive BOOLEAN NOT NULL DEFAULT FALSE,
+	is_default BOOLEAN NOT NULL DEFAULT FALSE,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX tax_rates_name_key ON tax_rates (LOWER(name));
+CREATE UNIQUE INDEX tax_rates_default_key ON tax_rates (is_default) WHERE is_default;
+
+ALTER TABLE products ADD COLUMN tax_rate_id INT REFERENCES tax_rates(id) ON DELETE SET NULL;
+ALTER TABLE categories ADD COLUMN tax_rate_id INT REFERENCES tax_rates(id) ON DELETE SET NULL;
+
+-- Lines snapshot the rate they were taxed at. subtotal stays the discounted
+-- line at shelf price; total adds exclusive tax and is what was charged.
+-- Existing sales were untaxed.
+ALTER TABLE transaction_details
+	ADD COLUMN tax_rate_id INT REFERENCES tax_rates(id) ON DELETE SET NULL,
+	ADD COLUMN tax_name VARCHAR(50) NOT NULL DEFAULT '',
+	ADD COLUMN tax_rate NUMERIC(5, 2) NOT NULL DEFAULT 0,
+	ADD COLUMN tax_inclusive BOOLEAN NOT NULL DEFAULT FALSE,
+	ADD COLUMN tax_amount INT NOT NULL DEFAULT 0,
+	ADD COLUMN total INT;
+
+UPDATE transaction_details SET total = subtotal;
+ALTER TABLE transaction_details ALTER COLUMN total SET NOT NULL;
+
+ALTER TABLE transactions ADD COLUMN tax_amount INT NOT NULL DEFAULT 0;
+
+-- The tax contained in each refunded amount.
+ALTER TABLE transaction_reversal_items ADD COLUMN tax_amount INT NOT NULL DEFAULT 0;
@@ -0,0 +1,84 @@
+// Package export writes tabular data as CSV, XLSX or NDJSON one row at a
+// time, so exports of any size stream without being held in memory.
+package export
+
+import (
+	"category-api/apperrors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Supported export formats.
+const (
+	FormatCSV    = "csv"
+	FormatXLSX   = "xlsx"
+	FormatNDJSON = "ndjson"
+)
+
+// ErrUnsupportedFormat is returned for a format other than csv, xlsx or ndjson.
+var ErrUnsupportedFormat = apperrors.BadRequest("unsupported_format", "format must be one of csv, xlsx, ndjson")
+
+// Writer writes rows whose values line up with the columns it was created
+// with. Values may be strings, ints or time.Time. Close must be called to
+// complete the output.
+type Writer interface {
+	WriteRow(values ...interface{}) error
+	Close() error
+}
+
+// NewWriter returns a Writer producing format on w. The header, if the
+// format has one, is written immediately.
+func NewWriter(w io.Writer, format string, columns []string) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(w, columns)
+	case FormatXLSX:
+		return newXLSXWriter(w, columns)
+	case FormatNDJSON:
+		return newNDJSONWriter(w, columns), nil
+	default:
+		return nil, unsupported(format)
+	}
+}
+
+// CheckFormat returns ErrUnsupportedFormat unless format is supported.
+func CheckFormat(format string) error {
+	if ContentType(format) == "" {
+		return unsupported(format)
+	}
+	return nil
+}
+
+func unsupported(format string) error {
+	return ErrUnsupportedFormat.WithMessage(fmt.Sprintf("unsupported format %q; use csv, xlsx or ndjson", format))
+}
+
+// ContentType returns the media type of format, or "" if it is unsupported.
+func ContentType(format string) string {
+	switch format {
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatXLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	case FormatNDJSON:
+		return "application/x-ndjson"
+	default:
+		return ""
+	}
+}
+
+// formatValue renders a value as text for formats without native types.
+func formatValue(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case time.Time:
+		return v.Format(time.RFC3339)
+	default:
+		return fmt.Sprint(v)
+	}
+}
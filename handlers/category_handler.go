@@ -4,10 +4,16 @@ import (
 	"category-api/models"
 	"category-api/services"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"strings"
+	"time"
 )
 
+// categorySeedFormat is the export format that writes categories as a
+// categories.json seed file instead of rows.
+const categorySeedFormat = "json"
+
 type CategoryHandler struct {
 	service services.CategoryService
 }
@@ -26,7 +32,86 @@ func (h *CategoryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		case http.MethodPost:
 			h.createCategory(w, r)
 		default:
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			methodNotAllowed(w, r)
+		}
+		return
+	}
+
+	// Handle /api/categories/tree
+	if r.URL.Path == "/api/categories/tree" {
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, r)
+			return
+		}
+		h.getCategoryTree(w, r)
+		return
+	}
+
+	// Handle /api/categories/export
+	if r.URL.Path == "/api/categories/export" {
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, r)
+			return
+		}
+		h.exportCategories(w, r)
+		return
+	}
+
+	// Handle /api/categories/import
+	if r.URL.Path == "/api/categories/import" {
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, r)
+			return
+		}
+		h.importCategories(w, r)
+		return
+	}
+
+	// Handle /api/categories/by-slug/{slug}
+	if strings.HasPrefix(r.URL.Path, "/api/categories/by-slug/") {
+		slug := strings.TrimPrefix(r.URL.Path, "/api/categories/by-slug/")
+		if slug == "" || strings.Contains(slug, "/") {
+			NotFound(w, r)
+			return
+		}
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, r)
+			return
+		}
+		h.getCategoryBySlug(w, r, slug)
+		return
+	}
+
+	// Handle /api/categories/{id}/restore
+	if strings.HasPrefix(r.URL.Path, "/api/categories/") && strings.HasSuffix(r.URL.Path, "/restore") {
+		id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/categories/"), "/restore")
+		if id == "" || strings.Contains(id, "/") {
+			writeError(w, r, errInvalidID)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodPost:
+			h.restoreCategory(w, r, id)
+		default:
+			methodNotAllowed(w, r)
+		}
+		return
+	}
+
+	// Handle /api/categories/{id}/produk
+	if strings.HasPrefix(r.URL.Path, "/api/categories/") && strings.HasSuffix(r.URL.Path, "/produk") {
+		id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/categories/"), "/produk")
+		if id == "" || strings.Contains(id, "/") {
+			writeError(w, r, errInvalidID)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			h.getCategoryProducts(w, r, id)
+		default:
+			methodNotAllowed(w, r)
 		}
 		return
 	}
@@ -35,7 +120,7 @@ func (h *CategoryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if strings.HasPrefix(r.URL.Path, "/api/categories/") {
 		id := strings.TrimPrefix(r.URL.Path, "/api/categories/")
 		if id == "" {
-			http.Error(w, "Invalid ID", http.StatusBadRequest)
+			writeError(w, r, errInvalidID)
 			return
 		}
 
@@ -47,88 +132,209 @@ func (h *CategoryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		case http.MethodDelete:
 			h.deleteCategory(w, r, id)
 		default:
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			methodNotAllowed(w, r)
 		}
 		return
 	}
 
-	http.NotFound(w, r)
+	NotFound(w, r)
 }
 
+// getAllCategories lists categories. Supports name search, include_deleted,
+// sort=name,-product_count and page/limit; the total count is returned in the X-Total-Count and Link headers.
 func (h *CategoryHandler) getAllCategories(w http.ResponseWriter, r *http.Request) {
-	categories, err := h.service.GetAll()
+	filter, err := parseCategoryFilter(r.URL.Query())
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(categories)
+	categories, total, err := h.service.GetAll(filter)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if categories == nil {
+		categories = []models.Category{}
+	}
+
+	setPaginationHeaders(w, r, filter.Pagination, total)
+	writeJSON(w, http.StatusOK, categories)
+}
+
+// getCategoryTree returns every category nested under its parent.
+func (h *CategoryHandler) getCategoryTree(w http.ResponseWriter, r *http.Request) {
+	tree, err := h.service.Tree()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if tree == nil {
+		tree = []models.CategoryNode{}
+	}
+	writeJSON(w, http.StatusOK, tree)
 }
 
 func (h *CategoryHandler) getCategoryByID(w http.ResponseWriter, r *http.Request, id string) {
 	category, err := h.service.GetByID(id)
 	if err != nil {
-		http.Error(w, `{"error": "Category not found"}`, http.StatusNotFound)
+		writeError(w, r, err)
 		return
 	}
+	writeJSON(w, http.StatusOK, category)
+}
+
+func (h *CategoryHandler) getCategoryBySlug(w http.ResponseWriter, r *http.Request, slug string) {
+	category, err := h.service.GetBySlug(slug)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, category)
+}
+
+// exportCategories streams the categories matching the list filters as csv,
+// xlsx or ndjson, or with format=json writes them as a seed file that
+// POST /api/categories/import reads back.
+func (h *CategoryHandler) exportCategories(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseCategoryFilter(r.URL.Query())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if r.URL.Query().Get("format") == categorySeedFormat {
+		h.exportCategorySeed(w, r, filter)
+		return
+	}
+	stream, err := newExportStream(w, r, "categories", []string{"id", "name", "slug", "description", "parent_id", "product_count"})
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	stream.finish(h.service.Export(filter, func(c models.Category) error {
+		return stream.row(c.ID, c.Name, c.Slug, c.Description, c.ParentID, c.ProductCount)
+	}))
+}
+
+// exportCategorySeed writes the categories matching filter in the
+// categories.json seed format, indented so it diffs well under version control.
+func (h *CategoryHandler) exportCategorySeed(w http.ResponseWriter, r *http.Request, filter models.CategoryFilter) {
+	seeds, err := h.service.ExportSeed(filter)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	body, err := json.MarshalIndent(seeds, "", "  ")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	filename := fmt.Sprintf("categories-%s.json", time.Now().Format("20060102-150405"))
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(category)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	w.WriteHeader(http.StatusOK)
+	w.Write(append(body, '\n'))
 }
 
-func (h *CategoryHandler) createCategory(w http.ResponseWriter, r *http.Request) {
-	var input models.Category
+// importCategories upserts the categories of a categories.json seed file by
+// ID; ?dry_run=true only validates and reports per-category errors.
+func (h *CategoryHandler) importCategories(w http.ResponseWriter, r *http.Request) {
+	dryRun, err := parseBoolParam(r.URL.Query(), "dry_run")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
 
-	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		http.Error(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
+	result, err := h.service.Import(http.MaxBytesReader(w, r.Body, maxImportSize), dryRun)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (h *CategoryHandler) getCategoryProducts(w http.ResponseWriter, r *http.Request, id string) {
+	filter, err := parseProductFilter(r.URL.Query())
+	if err != nil {
+		writeError(w, r, err)
 		return
 	}
 
-	if input.Name == "" {
-		http.Error(w, `{"error": "Name is required"}`, http.StatusBadRequest)
+	products, total, err := h.service.GetProducts(id, filter)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if products == nil {
+		products = []models.Produk{}
+	}
+
+	setPaginationHeaders(w, r, filter.Pagination, total)
+	writeJSON(w, http.StatusOK, products)
+}
+
+func (h *CategoryHandler) createCategory(w http.ResponseWriter, r *http.Request) {
+	var input models.Category
+
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, r, errInvalidBody)
 		return
 	}
 
 	newCategory, err := h.service.Create(input)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(newCategory)
+	writeJSON(w, http.StatusCreated, newCategory)
 }
 
 func (h *CategoryHandler) updateCategory(w http.ResponseWriter, r *http.Request, id string) {
 	var input models.Category
 
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		http.Error(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
+		writeError(w, r, errInvalidBody)
 		return
 	}
 
-	if input.Name == "" {
-		http.Error(w, `{"error": "Name is required"}`, http.StatusBadRequest)
+	updatedCategory, err := h.service.Update(id, input)
+	if err != nil {
+		writeError(w, r, err)
 		return
 	}
 
-	updatedCategory, err := h.service.Update(id, input)
+	writeJSON(w, http.StatusOK, updatedCategory)
+}
+
+// deleteCategory soft deletes a category. A category that still has products
+// or subcategories needs reassign_to={id} to move them or cascade=true to
+// delete them along with it.
+func (h *CategoryHandler) deleteCategory(w http.ResponseWriter, r *http.Request, id string) {
+	q := r.URL.Query()
+	cascade, err := parseBoolParam(q, "cascade")
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
+		return
+	}
+	opts := models.CategoryDeleteOptions{ReassignTo: q.Get("reassign_to"), Cascade: cascade}
+	if err := h.service.Delete(id, opts); err != nil {
+		writeError(w, r, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(updatedCategory)
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Category deleted successfully"})
 }
 
-func (h *CategoryHandler) deleteCategory(w http.ResponseWriter, r *http.Request, id string) {
-	if err := h.service.Delete(id); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+func (h *CategoryHandler) restoreCategory(w http.ResponseWriter, r *http.Request, id string) {
+	category, err := h.service.Restore(id)
+	if err != nil {
+		writeError(w, r, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write([]byte(`{"message": "Category deleted successfully"}`))
+	writeJSON(w, http.StatusOK, category)
 }
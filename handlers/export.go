@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"category-api/export"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// exportStream writes an export response row by row. The response starts
+// with the first row, so errors raised before it (bad filters, a failing
+// query) still get a JSON error envelope. Once rows have been sent an error
+// can only abort the connection, leaving the client with a truncated file.
+type exportStream struct {
+	w       http.ResponseWriter
+	r       *http.Request
+	format  string
+	name    string
+	columns []string
+	out     export.Writer
+}
+
+// newExportStream validates the format query parameter (default csv) of an
+// export named name, e.g. "produk".
+func newExportStream(w http.ResponseWriter, r *http.Request, name string, columns []string) (*exportStream, error) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = export.FormatCSV
+	}
+	if err := export.CheckFormat(format); err != nil {
+		return nil, err
+	}
+	return &exportStream{w: w, r: r, format: format, name: name, columns: columns}, nil
+}
+
+func (s *exportStream) start() error {
+	filename := fmt.Sprintf("%s-%s.%s", s.name, time.Now().Format("20060102-150405"), s.format)
+	s.w.Header().Set("Content-Type", export.ContentType(s.format))
+	s.w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	s.w.WriteHeader(http.StatusOK)
+
+	out, err := export.NewWriter(s.w, s.format, s.columns)
+	if err != nil {
+		return err
+	}
+	s.out = out
+	return nil
+}
+
+// row writes one row, starting the response if needed.
+func (s *exportStream) row(values ...interface{}) error {
+	if s.out == nil {
+		if err := s.start(); err != nil {
+			return err
+		}
+	}
+	return s.out.WriteRow(values...)
+}
+
+// finish completes the export, or reports err from producing it.
+func (s *exportStream) finish(err error) {
+	if err == nil && s.out == nil {
+		// No rows matched; still send a file with just the header
+		err = s.start()
+	}
+	if err == nil {
+		err = s.out.Close()
+	}
+	if err == nil {
+		return
+	}
+	if s.out == nil {
+		writeError(s.w, s.r, err)
+		return
+	}
+	log.Printf("[%s] %s %s: export aborted: %v", RequestID(s.r), s.r.Method, s.r.URL.Path, err)
+	panic(http.ErrAbortHandler)
+}
@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"category-api/apperrors"
+	"category-api/models"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const dateLayout = "2006-01-02"
+
+// errInvalidParam is returned for malformed query parameters.
+var errInvalidParam = apperrors.BadRequest("invalid_parameter", "invalid query parameter")
+
+// parseDateParam reads an optional YYYY-MM-DD query parameter as a date at
+// midnight UTC; services map it onto the store's business day. The zero time
+// is returned when the parameter is absent.
+func parseDateParam(q url.Values, name string) (time.Time, error) {
+	v := q.Get(name)
+	if v == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(dateLayout, v)
+	if err != nil {
+		return time.Time{}, errInvalidParam.WithMessage(fmt.Sprintf("invalid %s %q, expected YYYY-MM-DD", name, v))
+	}
+	return t, nil
+}
+
+// parseIntParam reads an optional non-negative integer query parameter.
+// nil is returned when the parameter is absent.
+func parseIntParam(q url.Values, name string) (*int, error) {
+	v := q.Get(name)
+	if v == "" {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return nil, errInvalidParam.WithMessage(fmt.Sprintf("invalid %s %q", name, v))
+	}
+	return &n, nil
+}
+
+// parseBoolParam reads an optional boolean query parameter such as dry_run=true.
+func parseBoolParam(q url.Values, name string) (bool, error) {
+	v := q.Get(name)
+	if v == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, errInvalidParam.WithMessage(fmt.Sprintf("invalid %s %q", name, v))
+	}
+	return b, nil
+}
+
+// parsePagination reads the page and limit query parameters and applies the defaults.
+func parsePagination(q url.Values) (models.Pagination, error) {
+	var p models.Pagination
+	page, err := parseIntParam(q, "page")
+	if err != nil {
+		return p, err
+	}
+	limit, err := parseIntParam(q, "limit")
+	if err != nil {
+		return p, err
+	}
+	if page != nil {
+		p.Page = *page
+	}
+	if limit != nil {
+		p.Limit = *limit
+	}
+	p.Normalize()
+	return p, nil
+}
+
+// parseProductFilter reads the product list filters shared by every endpoint
+// listing products. include_deleted=true also lists soft deleted products and
+// include_descendants=true widens category_id to its subcategories.
+func parseProductFilter(q url.Values) (models.ProductFilter, error) {
+	filter := models.ProductFilter{
+		Name:       q.Get("name"),
+		CategoryID: q.Get("category_id"),
+		SKU:        q.Get("sku"),
+		Sort:       q.Get("sort"),
+	}
+
+	var err error
+	if filter.IncludeDeleted, err = parseBoolParam(q, "include_deleted"); err != nil {
+		return filter, err
+	}
+	if filter.IncludeDescendants, err = parseBoolParam(q, "include_descendants"); err != nil {
+		return filter, err
+	}
+
+	bounds := map[string]**int{
+		"min_harga": &filter.MinHarga,
+		"max_harga": &filter.MaxHarga,
+		"min_stok":  &filter.MinStok,
+		"max_stok":  &filter.MaxStok,
+	}
+	for name, dst := range bounds {
+		n, err := parseIntParam(q, name)
+		if err != nil {
+			return filter, err
+		}
+		*dst = n
+	}
+
+	filter.Pagination, err = parsePagination(q)
+	return filter, err
+}
+
+// parseCategoryFilter reads the category list filters shared by the list
+// and export endpoints.
+func parseCategoryFilter(q url.Values) (models.CategoryFilter, error) {
+	filter := models.CategoryFilter{Name: q.Get("name"), Sort: q.Get("sort")}
+	var err error
+	if filter.IncludeDeleted, err = parseBoolParam(q, "include_deleted"); err != nil {
+		return filter, err
+	}
+	filter.Pagination, err = parsePagination(q)
+	return filter, err
+}
+
+// setPaginationHeaders reports the total number of items in X-Total-Count and
+// links to the first, previous, next and last pages in an RFC 8288 Link header.
+func setPaginationHeaders(w http.ResponseWriter, r *http.Request, p models.Pagination, total int) {
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+
+	lastPage := (total + p.Limit - 1) / p.Limit
+	if lastPage < 1 {
+		lastPage = 1
+	}
+	pageURL := func(page int) string {
+		u := *r.URL
+		q := u.Query()
+		q.Set("page", strconv.Itoa(page))
+		q.Set("limit", strconv.Itoa(p.Limit))
+		u.RawQuery = q.Encode()
+		return u.RequestURI()
+	}
+
+	links := []string{fmt.Sprintf(`<%s>; rel="first"`, pageURL(1))}
+	if p.Page > 1 {
+		links = append(links, fmt.Sprintf(`<%s>; rel="prev"`, pageURL(p.Page-1)))
+	}
+	if p.Page < lastPage {
+		links = append(links, fmt.Sprintf(`<%s>; rel="next"`, pageURL(p.Page+1)))
+	}
+	links = append(links, fmt.Sprintf(`<%s>; rel="last"`, pageURL(lastPage)))
+	w.Header().Set("Link", strings.Join(links, ", "))
+}
+
+// actor returns who is making the request, as named by the X-Actor header.
+// It is recorded with every stock movement the request causes.
+func actor(r *http.Request) string {
+	return strings.TrimSpace(r.Header.Get("X-Actor"))
+}
+
+// parseStockMovementFilter reads the variant_id, type and page/limit query
+// parameters of a product's stock ledger.
+func parseStockMovementFilter(productID int, q url.Values) (models.StockMovementFilter, error) {
+	filter := models.StockMovementFilter{ProductID: productID, Type: q.Get("type")}
+	variantID, err := parseIntParam(q, "variant_id")
+	if err != nil {
+		return filter, err
+	}
+	if variantID != nil {
+		filter.VariantID = *variantID
+	}
+	filter.Pagination, err = parsePagination(q)
+	return filter, err
+}
@@ -4,11 +4,15 @@ import (
 	"category-api/models"
 	"category-api/services"
 	"encoding/json"
+	"mime"
 	"net/http"
 	"strconv"
 	"strings"
 )
 
+// maxImportSize bounds the body of a product import.
+const maxImportSize = 20 << 20
+
 type ProductHandler struct {
 	service services.ProductService
 }
@@ -26,8 +30,80 @@ func (h *ProductHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		case http.MethodPost:
 			h.createProduk(w, r)
 		default:
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			methodNotAllowed(w, r)
+		}
+		return
+	}
+
+	// Handle /api/produk/export
+	if r.URL.Path == "/api/produk/export" {
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, r)
+			return
+		}
+		h.exportProduk(w, r)
+		return
+	}
+
+	// Handle /api/produk/import
+	if r.URL.Path == "/api/produk/import" {
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, r)
+			return
+		}
+		h.importProduk(w, r)
+		return
+	}
+
+	// Handle /api/produk/low-stock
+	if r.URL.Path == "/api/produk/low-stock" {
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, r)
+			return
+		}
+		h.getLowStock(w, r)
+		return
+	}
+
+	// Handle /api/produk/barcode/{code}
+	if strings.HasPrefix(r.URL.Path, "/api/produk/barcode/") {
+		code := strings.TrimPrefix(r.URL.Path, "/api/produk/barcode/")
+		if code == "" {
+			NotFound(w, r)
+			return
+		}
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, r)
+			return
+		}
+		h.getProdukByBarcode(w, r, code)
+		return
+	}
+
+	// Handle /api/produk/{id}/variants and /api/produk/{id}/variants/{variantID}
+	if strings.HasPrefix(r.URL.Path, "/api/produk/") && strings.Contains(r.URL.Path, "/variants") {
+		h.serveVariants(w, r)
+		return
+	}
+
+	// Handle /api/produk/{id}/stock-movements and /api/produk/{id}/stock-adjustments
+	if strings.HasPrefix(r.URL.Path, "/api/produk/") && strings.Contains(r.URL.Path, "/stock-") {
+		h.serveStock(w, r)
+		return
+	}
+
+	// Handle /api/produk/{id}/restore
+	if strings.HasPrefix(r.URL.Path, "/api/produk/") && strings.HasSuffix(r.URL.Path, "/restore") {
+		id, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/produk/"), "/restore"))
+		if err != nil {
+			writeError(w, r, errInvalidID)
+			return
 		}
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, r)
+			return
+		}
+		h.restoreProduk(w, r, id)
 		return
 	}
 
@@ -36,7 +112,7 @@ func (h *ProductHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		idStr := strings.TrimPrefix(r.URL.Path, "/api/produk/")
 		id, err := strconv.Atoi(idStr)
 		if err != nil {
-			http.Error(w, "Invalid ID", http.StatusBadRequest)
+			writeError(w, r, errInvalidID)
 			return
 		}
 
@@ -48,80 +124,316 @@ func (h *ProductHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		case http.MethodDelete:
 			h.deleteProduk(w, r, id)
 		default:
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			methodNotAllowed(w, r)
 		}
 		return
 	}
-	
-	http.NotFound(w, r)
+
+	NotFound(w, r)
 }
 
+// getAllProduk lists products. Supports name search, category_id, sku,
+// include_deleted, min/max_harga and min/max_stok filters, sort=harga,-nama
+// and page/limit; the total count is returned in the X-Total-Count and Link
+// headers.
 func (h *ProductHandler) getAllProduk(w http.ResponseWriter, r *http.Request) {
-	// Get name query parameter for search
-	name := r.URL.Query().Get("name")
-	
-	products, err := h.service.GetAll(name)
+	filter, err := parseProductFilter(r.URL.Query())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	products, total, err := h.service.GetAll(filter)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
-	
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(products)
+	if products == nil {
+		products = []models.Produk{}
+	}
+
+	setPaginationHeaders(w, r, filter.Pagination, total)
+	writeJSON(w, http.StatusOK, products)
 }
 
 func (h *ProductHandler) createProduk(w http.ResponseWriter, r *http.Request) {
 	var p models.Produk
 	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, r, errInvalidBody)
+		return
+	}
+
+	createdProduk, err := h.service.Create(p, actor(r))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, createdProduk)
+}
+
+// exportProduk streams the products matching the list filters as csv, xlsx
+// or ndjson. The columns match the import format so files can be re-imported.
+func (h *ProductHandler) exportProduk(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseProductFilter(r.URL.Query())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	stream, err := newExportStream(w, r, "produk", []string{"id", "sku", "nama", "harga", "harga_pokok", "stok", "reorder_point", "category_id", "barcodes"})
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	stream.finish(h.service.Export(filter, func(p models.Produk) error {
+		return stream.row(p.ID, p.SKU, p.Nama, p.Harga, p.HargaPokok, p.Stok, p.ReorderPoint, p.CategoryID, strings.Join(p.Barcodes, "|"))
+	}))
+}
+
+// importProduk bulk loads products from a CSV or JSON body, upserting by SKU.
+// The format comes from ?format= or the Content-Type; ?dry_run=true only
+// validates and reports per-line errors.
+func (h *ProductHandler) importProduk(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	dryRun, err := parseBoolParam(q, "dry_run")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	format := q.Get("format")
+	if format == "" {
+		format = services.ImportFormatJSON
+		if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "text/csv" {
+			format = services.ImportFormatCSV
+		}
+	}
+
+	result, err := h.service.Import(http.MaxBytesReader(w, r.Body, maxImportSize), format, dryRun, actor(r))
+	if err != nil {
+		writeError(w, r, err)
 		return
 	}
 
-	createdProduk, err := h.service.Create(p)
+	writeJSON(w, http.StatusOK, result)
+}
+
+// getLowStock lists the products and variants at or below their reorder
+// point, most urgent first. Supports a category_id filter.
+func (h *ProductHandler) getLowStock(w http.ResponseWriter, r *http.Request) {
+	items, err := h.service.GetLowStock(r.URL.Query().Get("category_id"))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
+	if items == nil {
+		items = []models.LowStockItem{}
+	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(createdProduk)
+	writeJSON(w, http.StatusOK, items)
 }
 
 func (h *ProductHandler) getProdukByID(w http.ResponseWriter, r *http.Request, id int) {
 	p, err := h.service.GetByID(id)
 	if err != nil {
-		http.Error(w, "Product not found", http.StatusNotFound)
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, p)
+}
+
+// getProdukByBarcode serves scanner lookups of a single barcode.
+func (h *ProductHandler) getProdukByBarcode(w http.ResponseWriter, r *http.Request, code string) {
+	p, err := h.service.GetByBarcode(code)
+	if err != nil {
+		writeError(w, r, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(p)
+	writeJSON(w, http.StatusOK, p)
 }
 
 func (h *ProductHandler) updateProduk(w http.ResponseWriter, r *http.Request, id int) {
-	var p models.Produk
-	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	var u models.ProdukUpdate
+	if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+		writeError(w, r, errInvalidBody)
 		return
 	}
 
-	updatedProduk, err := h.service.Update(id, p)
+	updatedProduk, err := h.service.Update(id, u)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(updatedProduk)
+	writeJSON(w, http.StatusOK, updatedProduk)
 }
 
 func (h *ProductHandler) deleteProduk(w http.ResponseWriter, r *http.Request, id int) {
 	if err := h.service.Delete(id); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write([]byte(`{"message": "Product deleted"}`))
-}
\ No newline at end of file
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Product deleted"})
+}
+
+func (h *ProductHandler) restoreProduk(w http.ResponseWriter, r *http.Request, id int) {
+	p, err := h.service.Restore(id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, p)
+}
+
+// serveStock routes the stock ledger endpoints of a product.
+func (h *ProductHandler) serveStock(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/produk/"), "/")
+	if len(parts) != 2 {
+		NotFound(w, r)
+		return
+	}
+	productID, err := strconv.Atoi(parts[0])
+	if err != nil {
+		writeError(w, r, errInvalidID)
+		return
+	}
+
+	switch parts[1] {
+	case "stock-movements":
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, r)
+			return
+		}
+		h.getStockMovements(w, r, productID)
+	case "stock-adjustments":
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, r)
+			return
+		}
+		h.adjustStock(w, r, productID)
+	default:
+		NotFound(w, r)
+	}
+}
+
+// getStockMovements lists a product's stock ledger, newest first. Supports
+// variant_id and type filters and page/limit.
+func (h *ProductHandler) getStockMovements(w http.ResponseWriter, r *http.Request, productID int) {
+	filter, err := parseStockMovementFilter(productID, r.URL.Query())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	movements, total, err := h.service.GetStockMovements(filter)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if movements == nil {
+		movements = []models.StockMovement{}
+	}
+
+	setPaginationHeaders(w, r, filter.Pagination, total)
+	writeJSON(w, http.StatusOK, movements)
+}
+
+// adjustStock records a manual stock change and returns the ledger entry.
+func (h *ProductHandler) adjustStock(w http.ResponseWriter, r *http.Request, productID int) {
+	var req models.StockAdjustmentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, errInvalidBody)
+		return
+	}
+	req.Actor = actor(r)
+
+	movement, err := h.service.AdjustStock(productID, req)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, movement)
+}
+
+// serveVariants routes the variant endpoints of a product.
+func (h *ProductHandler) serveVariants(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/produk/"), "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[1] != "variants" {
+		NotFound(w, r)
+		return
+	}
+	productID, err := strconv.Atoi(parts[0])
+	if err != nil {
+		writeError(w, r, errInvalidID)
+		return
+	}
+
+	if len(parts) == 2 {
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, r)
+			return
+		}
+		h.createVariant(w, r, productID)
+		return
+	}
+
+	variantID, err := strconv.Atoi(parts[2])
+	if err != nil {
+		writeError(w, r, errInvalidID)
+		return
+	}
+	switch r.Method {
+	case http.MethodPut:
+		h.updateVariant(w, r, productID, variantID)
+	case http.MethodDelete:
+		h.deleteVariant(w, r, productID, variantID)
+	default:
+		methodNotAllowed(w, r)
+	}
+}
+
+func (h *ProductHandler) createVariant(w http.ResponseWriter, r *http.Request, productID int) {
+	var v models.ProductVariant
+	if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
+		writeError(w, r, errInvalidBody)
+		return
+	}
+
+	created, err := h.service.CreateVariant(productID, v, actor(r))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, created)
+}
+
+func (h *ProductHandler) updateVariant(w http.ResponseWriter, r *http.Request, productID, id int) {
+	var v models.ProductVariant
+	if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
+		writeError(w, r, errInvalidBody)
+		return
+	}
+
+	updated, err := h.service.UpdateVariant(productID, id, v)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, updated)
+}
+
+func (h *ProductHandler) deleteVariant(w http.ResponseWriter, r *http.Request, productID, id int) {
+	if err := h.service.DeleteVariant(productID, id); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Variant deleted"})
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"category-api/models"
+	"category-api/services"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type PromoHandler struct {
+	service services.PromoService
+}
+
+func NewPromoHandler(service services.PromoService) *PromoHandler {
+	return &PromoHandler{service: service}
+}
+
+func (h *PromoHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Handle /api/promo-codes
+	if r.URL.Path == "/api/promo-codes" {
+		switch r.Method {
+		case http.MethodGet:
+			h.getAllPromos(w, r)
+		case http.MethodPost:
+			h.createPromo(w, r)
+		default:
+			methodNotAllowed(w, r)
+		}
+		return
+	}
+
+	// Handle /api/promo-codes/{id}
+	if strings.HasPrefix(r.URL.Path, "/api/promo-codes/") {
+		id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/api/promo-codes/"))
+		if err != nil {
+			writeError(w, r, errInvalidID)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			h.getPromoByID(w, r, id)
+		case http.MethodPut:
+			h.updatePromo(w, r, id)
+		case http.MethodDelete:
+			h.deletePromo(w, r, id)
+		default:
+			methodNotAllowed(w, r)
+		}
+		return
+	}
+
+	NotFound(w, r)
+}
+
+func (h *PromoHandler) getAllPromos(w http.ResponseWriter, r *http.Request) {
+	promos, err := h.service.GetAll()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, promos)
+}
+
+func (h *PromoHandler) getPromoByID(w http.ResponseWriter, r *http.Request, id int) {
+	promo, err := h.service.GetByID(id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, promo)
+}
+
+// createPromo adds a promo code; it is active unless the body says otherwise.
+func (h *PromoHandler) createPromo(w http.ResponseWriter, r *http.Request) {
+	input := models.PromoCode{Active: true}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, r, errInvalidBody)
+		return
+	}
+
+	promo, err := h.service.Create(input)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, promo)
+}
+
+// updatePromo replaces a promo code's settings. Like createPromo, it keeps
+// the code active unless the body says otherwise.
+func (h *PromoHandler) updatePromo(w http.ResponseWriter, r *http.Request, id int) {
+	input := models.PromoCode{Active: true}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, r, errInvalidBody)
+		return
+	}
+
+	promo, err := h.service.Update(id, input)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, promo)
+}
+
+func (h *PromoHandler) deletePromo(w http.ResponseWriter, r *http.Request, id int) {
+	if err := h.service.Delete(id); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Promo code deleted successfully"})
+}
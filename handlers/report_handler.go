@@ -2,7 +2,6 @@ package handlers
 
 import (
 	"category-api/services"
-	"encoding/json"
 	"net/http"
 	"strings"
 )
@@ -22,21 +21,56 @@ func (h *ReportHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		case http.MethodGet:
 			h.getDailyReport(w, r)
 		default:
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			methodNotAllowed(w, r)
 		}
 		return
 	}
 
-	http.NotFound(w, r)
+	// Handle /api/report?start_date=&end_date=
+	if r.URL.Path == "/api/report" {
+		switch r.Method {
+		case http.MethodGet:
+			h.getReport(w, r)
+		default:
+			methodNotAllowed(w, r)
+		}
+		return
+	}
+
+	NotFound(w, r)
 }
 
 func (h *ReportHandler) getDailyReport(w http.ResponseWriter, r *http.Request) {
 	report, err := h.service.GetDailyReport()
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(report)
-}
\ No newline at end of file
+	writeJSON(w, http.StatusOK, report)
+}
+
+// getReport serves the report for start_date through end_date (inclusive).
+// A missing bound defaults to the current business day, so no parameters
+// means today's report.
+func (h *ReportHandler) getReport(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	startDate, err := parseDateParam(q, "start_date")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	endDate, err := parseDateParam(q, "end_date")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	report, err := h.service.GetReport(startDate, endDate)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, report)
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"category-api/apperrors"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+type contextKey string
+
+const requestIDKey contextKey = "request_id"
+
+// ErrorResponse is the JSON envelope of every error returned by the API
+type ErrorResponse struct {
+	Code      string      `json:"code"`
+	Message   string      `json:"message"`
+	Details   interface{} `json:"details,omitempty"`
+	RequestID string      `json:"request_id"`
+}
+
+// WithRequestID tags every request with an ID, reusing the caller's
+// X-Request-ID when present. The ID is echoed in the response header and in
+// error bodies so client reports can be matched to server logs.
+func WithRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if id == "" || len(id) > 100 {
+			id = uuid.New().String()
+		}
+		w.Header().Set("X-Request-ID", id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey, id)))
+	})
+}
+
+// RequestID returns the ID assigned to r by WithRequestID.
+func RequestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDKey).(string)
+	return id
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError renders err as an ErrorResponse. Errors that are not an
+// *apperrors.Error become a 500 whose cause is logged, not returned.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	appErr := apperrors.From(err)
+	if appErr.Status >= http.StatusInternalServerError {
+		log.Printf("[%s] %s %s: %v", RequestID(r), r.Method, r.URL.Path, err)
+	}
+	writeJSON(w, appErr.Status, ErrorResponse{
+		Code:      appErr.Code,
+		Message:   appErr.Message,
+		Details:   appErr.Details,
+		RequestID: RequestID(r),
+	})
+}
+
+var (
+	errInvalidID        = apperrors.BadRequest("invalid_id", "invalid ID")
+	errInvalidBody      = apperrors.BadRequest(apperrors.CodeBadRequest, "invalid request body")
+	errMethodNotAllowed = apperrors.New(http.StatusMethodNotAllowed, apperrors.CodeMethodNotAllowed, "method not allowed")
+	errRouteNotFound    = apperrors.NotFound(apperrors.CodeNotFound, "resource not found")
+)
+
+func methodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, errMethodNotAllowed)
+}
+
+// NotFound answers a request for an unknown route with a not_found error.
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, errRouteNotFound)
+}
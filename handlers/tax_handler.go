@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"category-api/models"
+	"category-api/services"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type TaxHandler struct {
+	service services.TaxService
+}
+
+func NewTaxHandler(service services.TaxService) *TaxHandler {
+	return &TaxHandler{service: service}
+}
+
+func (h *TaxHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Handle /api/tax-rates
+	if r.URL.Path == "/api/tax-rates" {
+		switch r.Method {
+		case http.MethodGet:
+			h.getAllTaxRates(w, r)
+		case http.MethodPost:
+			h.createTaxRate(w, r)
+		default:
+			methodNotAllowed(w, r)
+		}
+		return
+	}
+
+	// Handle /api/tax-rates/{id}
+	if strings.HasPrefix(r.URL.Path, "/api/tax-rates/") {
+		id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/api/tax-rates/"))
+		if err != nil {
+			writeError(w, r, errInvalidID)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			h.getTaxRateByID(w, r, id)
+		case http.MethodPut:
+			h.updateTaxRate(w, r, id)
+		case http.MethodDelete:
+			h.deleteTaxRate(w, r, id)
+		default:
+			methodNotAllowed(w, r)
+		}
+		return
+	}
+
+	NotFound(w, r)
+}
+
+func (h *TaxHandler) getAllTaxRates(w http.ResponseWriter, r *http.Request) {
+	rates, err := h.service.GetAll()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, rates)
+}
+
+func (h *TaxHandler) getTaxRateByID(w http.ResponseWriter, r *http.Request, id int) {
+	rate, err := h.service.GetByID(id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, rate)
+}
+
+func (h *TaxHandler) createTaxRate(w http.ResponseWriter, r *http.Request) {
+	var input models.TaxRate
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, r, errInvalidBody)
+		return
+	}
+
+	rate, err := h.service.Create(input)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, rate)
+}
+
+func (h *TaxHandler) updateTaxRate(w http.ResponseWriter, r *http.Request, id int) {
+	var input models.TaxRate
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, r, errInvalidBody)
+		return
+	}
+
+	rate, err := h.service.Update(id, input)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, rate)
+}
+
+func (h *TaxHandler) deleteTaxRate(w http.ResponseWriter, r *http.Request, id int) {
+	if err := h.service.Delete(id); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Tax rate deleted successfully"})
+}
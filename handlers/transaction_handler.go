@@ -1,10 +1,15 @@
 package handlers
 
 import (
+	"category-api/apperrors"
 	"category-api/models"
 	"category-api/services"
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 )
 
 type TransactionHandler struct {
@@ -21,28 +26,209 @@ func (h *TransactionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		case http.MethodPost:
 			h.checkout(w, r)
 		default:
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			methodNotAllowed(w, r)
 		}
 		return
 	}
 
-	http.NotFound(w, r)
+	// Handle /api/transactions
+	if r.URL.Path == "/api/transactions" {
+		switch r.Method {
+		case http.MethodGet:
+			h.listTransactions(w, r)
+		default:
+			methodNotAllowed(w, r)
+		}
+		return
+	}
+
+	// Handle /api/transactions/export
+	if r.URL.Path == "/api/transactions/export" {
+		switch r.Method {
+		case http.MethodGet:
+			h.exportTransactions(w, r)
+		default:
+			methodNotAllowed(w, r)
+		}
+		return
+	}
+
+	// Handle /api/transactions/{id} and /api/transactions/{id}/{void|refund}
+	if strings.HasPrefix(r.URL.Path, "/api/transactions/") {
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/transactions/"), "/")
+		id, err := strconv.Atoi(parts[0])
+		if err != nil {
+			writeError(w, r, errInvalidID)
+			return
+		}
+
+		switch {
+		case len(parts) == 1:
+			switch r.Method {
+			case http.MethodGet:
+				h.getTransactionByID(w, r, id)
+			default:
+				methodNotAllowed(w, r)
+			}
+		case len(parts) == 2 && (parts[1] == "void" || parts[1] == "refund"):
+			if r.Method != http.MethodPost {
+				methodNotAllowed(w, r)
+				return
+			}
+			if parts[1] == "void" {
+				h.voidTransaction(w, r, id)
+			} else {
+				h.refundTransaction(w, r, id)
+			}
+		default:
+			NotFound(w, r)
+		}
+		return
+	}
+
+	NotFound(w, r)
 }
 
 func (h *TransactionHandler) checkout(w http.ResponseWriter, r *http.Request) {
 	var req models.CheckoutRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, r, errInvalidBody)
+		return
+	}
+	req.Actor = actor(r)
+
+	// Retried requests carrying the same Idempotency-Key replay the first response
+	var response models.CheckoutResponse
+	var replayed bool
+	var err error
+	if key := r.Header.Get("Idempotency-Key"); key != "" {
+		if len(key) > 255 {
+			writeError(w, r, apperrors.BadRequest("invalid_idempotency_key", "Idempotency-Key must be at most 255 characters"))
+			return
+		}
+		response, replayed, err = h.service.CheckoutIdempotent(key, req)
+	} else {
+		response, err = h.service.Checkout(req)
+	}
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	if replayed {
+		w.Header().Set("Idempotent-Replayed", "true")
+	}
+	writeJSON(w, http.StatusCreated, response)
+}
+
+func (h *TransactionHandler) listTransactions(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseTransactionFilter(r.URL.Query())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	response, err := h.service.ListTransactions(filter, r.URL.Query().Get("cursor"))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (h *TransactionHandler) getTransactionByID(w http.ResponseWriter, r *http.Request, id int) {
+	response, err := h.service.GetTransaction(id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (h *TransactionHandler) voidTransaction(w http.ResponseWriter, r *http.Request, id int) {
+	var req models.VoidRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, errInvalidBody)
+		return
+	}
+	req.Actor = actor(r)
+
+	reversal, err := h.service.Void(id, req)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, reversal)
+}
+
+func (h *TransactionHandler) refundTransaction(w http.ResponseWriter, r *http.Request, id int) {
+	var req models.RefundRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, errInvalidBody)
 		return
 	}
+	req.Actor = actor(r)
 
-	response, err := h.service.Checkout(req)
+	reversal, err := h.service.Refund(id, req)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, r, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(response)
-}
\ No newline at end of file
+	writeJSON(w, http.StatusCreated, reversal)
+}
+
+// exportTransactions streams the transactions matching the list filters as
+// csv, xlsx or ndjson, oldest first.
+func (h *TransactionHandler) exportTransactions(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseTransactionFilter(r.URL.Query())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	stream, err := newExportStream(w, r, "transactions", []string{"id", "created_at", "status", "gross_amount", "discount_amount", "tax_amount", "total_amount", "promo_code"})
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	stream.finish(h.service.Export(filter, func(t models.Transaction) error {
+		return stream.row(t.ID, t.CreatedAt, t.Status, t.GrossAmount, t.DiscountAmount, t.TaxAmount, t.TotalAmount, t.PromoCode)
+	}))
+}
+
+// parseTransactionFilter reads the history filters from the query string.
+// Dates are YYYY-MM-DD and both ends of the range are inclusive.
+func parseTransactionFilter(q url.Values) (models.TransactionFilter, error) {
+	var filter models.TransactionFilter
+	var err error
+
+	if filter.StartDate, err = parseDateParam(q, "start_date"); err != nil {
+		return filter, err
+	}
+	if filter.EndDate, err = parseDateParam(q, "end_date"); err != nil {
+		return filter, err
+	}
+
+	ints := map[string]*int{
+		"min_amount": &filter.MinAmount,
+		"max_amount": &filter.MaxAmount,
+		"product_id": &filter.ProductID,
+		"limit":      &filter.Limit,
+	}
+	for name, dst := range ints {
+		v := q.Get(name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return filter, errInvalidParam.WithMessage(fmt.Sprintf("invalid %s %q", name, v))
+		}
+		*dst = n
+	}
+	return filter, nil
+}
@@ -4,11 +4,14 @@ import (
 	"category-api/config"
 	"category-api/database"
 	"category-api/handlers"
+	"category-api/notifier"
 	"category-api/repositories"
 	"category-api/services"
-	"database/sql"
 	"log"
 	"net/http"
+	"os"
+	"time"
+	_ "time/tzdata" // store timezones must resolve in minimal containers
 )
 
 func main() {
@@ -18,27 +21,66 @@ func main() {
 	// 2. Connect Database
 	db := database.InitDB(cfg)
 	defer db.Close()
-	
-	// Create Tables
-	createTables(db)
+
+	// CLI commands (e.g. `main migrate up`) run and exit without serving HTTP
+	if len(os.Args) > 1 {
+		if err := runCommand(db, os.Args[1:]); err != nil {
+			log.Fatalf("%v", err)
+		}
+		return
+	}
+
+	// Apply pending schema migrations
+	if cfg.AutoMigrate {
+		if err := migrateUp(db); err != nil {
+			log.Fatalf("Failed to migrate database: %v", err)
+		}
+	}
 
 	// 3. Init Layers (Dependency Injection)
 	// Repositories
 	productRepo := repositories.NewProductRepository(db)
 	categoryRepo := repositories.NewCategoryRepository(db)
+	variantRepo := repositories.NewVariantRepository(db)
+	stockRepo := repositories.NewStockRepository(db)
 	transactionRepo := repositories.NewTransactionRepository(db)
+	reversalRepo := repositories.NewReversalRepository(db)
+	idempotencyRepo := repositories.NewIdempotencyRepository(db)
+	promoRepo := repositories.NewPromoRepository(db)
+	taxRepo := repositories.NewTaxRepository(db)
+
+	// Low-stock alert channels
+	alerts, err := notifier.New(notifier.Config{
+		Channels:       cfg.Notifiers,
+		WebhookURL:     cfg.AlertWebhook,
+		WebhookTimeout: cfg.WebhookTimeout,
+		SMTPAddr:       cfg.SMTPAddr,
+		EmailFrom:      cfg.AlertEmailFrom,
+		EmailTo:        cfg.AlertEmailTo,
+	})
+	if err != nil {
+		log.Fatalf("Invalid NOTIFIERS configuration: %v", err)
+	}
 
 	// Services
-	productService := services.NewProductService(productRepo)
-	categoryService := services.NewCategoryService(categoryRepo)
-	transactionService := services.NewTransactionService(transactionRepo, productRepo)
-	reportService := services.NewReportService(transactionRepo)
+	businessDay := services.BusinessDay{Location: cfg.StoreLocation, CutoffHour: cfg.BusinessDayCutoffHour}
+	productService := services.NewProductService(productRepo, categoryRepo, variantRepo, stockRepo)
+	categoryService := services.NewCategoryService(categoryRepo, productRepo)
+	transactionService := services.NewTransactionService(transactionRepo, reversalRepo, idempotencyRepo, cfg.IdempotencyTTL, businessDay, alerts)
+	reportService := services.NewReportService(transactionRepo, businessDay)
+	promoService := services.NewPromoService(promoRepo)
+	taxService := services.NewTaxService(taxRepo)
 
 	// Handlers
 	productHandler := handlers.NewProductHandler(productService)
 	categoryHandler := handlers.NewCategoryHandler(categoryService)
 	transactionHandler := handlers.NewTransactionHandler(transactionService)
 	reportHandler := handlers.NewReportHandler(reportService)
+	promoHandler := handlers.NewPromoHandler(promoService)
+	taxHandler := handlers.NewTaxHandler(taxService)
+
+	// Purge expired idempotency keys in the background
+	go purgeExpiredIdempotencyKeys(idempotencyRepo)
 
 	// 4. Setup Routing
 	http.HandleFunc("/api/categories", categoryHandler.ServeHTTP)
@@ -47,10 +89,21 @@ func main() {
 	http.HandleFunc("/api/produk", productHandler.ServeHTTP)
 	http.HandleFunc("/api/produk/", productHandler.ServeHTTP)
 
-	// Transaction (Checkout)
+	// Transaction (Checkout & History)
 	http.HandleFunc("/api/checkout", transactionHandler.ServeHTTP)
+	http.HandleFunc("/api/transactions", transactionHandler.ServeHTTP)
+	http.HandleFunc("/api/transactions/", transactionHandler.ServeHTTP)
+
+	// Promo codes
+	http.HandleFunc("/api/promo-codes", promoHandler.ServeHTTP)
+	http.HandleFunc("/api/promo-codes/", promoHandler.ServeHTTP)
+
+	// Tax rates
+	http.HandleFunc("/api/tax-rates", taxHandler.ServeHTTP)
+	http.HandleFunc("/api/tax-rates/", taxHandler.ServeHTTP)
 
 	// Report
+	http.HandleFunc("/api/report", reportHandler.ServeHTTP)
 	http.HandleFunc("/api/report/hari-ini", reportHandler.ServeHTTP)
 
 	// Health Check
@@ -62,7 +115,7 @@ func main() {
 	// Root
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path != "/" {
-			http.NotFound(w, r)
+			handlers.NotFound(w, r)
 			return
 		}
 		w.Write([]byte(`Welcome to Kasir API (Layered Architecture).`))
@@ -70,30 +123,19 @@ func main() {
 
 	// Run Server
 	log.Printf("Server starting on port %s...", cfg.AppPort)
-	if err := http.ListenAndServe(":"+cfg.AppPort, nil); err != nil {
+	if err := http.ListenAndServe(":"+cfg.AppPort, handlers.WithRequestID(http.DefaultServeMux)); err != nil {
 		log.Fatalf("Failed to start server: %v", err)
 	}
 }
 
-func createTables(db *sql.DB) {
-	queries := []string{
-		`CREATE TABLE IF NOT EXISTS categories (
-			id VARCHAR(50) PRIMARY KEY,
-			name VARCHAR(100) NOT NULL,
-			description TEXT
-		);`,
-		`CREATE TABLE IF NOT EXISTS products (
-			id SERIAL PRIMARY KEY,
-			nama VARCHAR(100) NOT NULL,
-			harga INT NOT NULL,
-			stok INT NOT NULL
-		);`,
-	}
-
-	for _, query := range queries {
-		if _, err := db.Exec(query); err != nil {
-			log.Fatalf("Failed to create table: %v", err)
+func purgeExpiredIdempotencyKeys(repo repositories.IdempotencyRepository) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for range ticker.C {
+		if n, err := repo.DeleteExpired(); err != nil {
+			log.Printf("Failed to purge expired idempotency keys: %v", err)
+		} else if n > 0 {
+			log.Printf("Purged %d expired idempotency keys", n)
 		}
 	}
-	log.Println("Database tables initialized")
-}
\ No newline at end of file
+}
@@ -1,7 +1,42 @@
 package models
 
+import "time"
+
+// Category groups products. Names are unique regardless of case and Slug is
+// the unique URL name of the category. Categories nest under an optional ParentID;
+// Path is the breadcrumb from the root category down to this one, filled in
+// on single-category responses. TaxRateID is the tax rate of products in the
+// category and its subcategories that have none of their own; 0 inherits the
+// rate of the parent. DeletedAt is set once the category has been soft deleted.
 type Category struct {
-	ID          string `json:"id"`
-	Name        string `json:"name"`
-	Description string `json:"description"`
+	ID           string        `json:"id"`
+	Name         string        `json:"name"`
+	Slug         string        `json:"slug"`
+	Description  string        `json:"description"`
+	ParentID     string        `json:"parent_id,omitempty"`
+	TaxRateID    int           `json:"tax_rate_id,omitempty"`
+	ProductCount int           `json:"product_count"`
+	Path         []CategoryRef `json:"path,omitempty"`
+	DeletedAt    *time.Time    `json:"deleted_at,omitempty"`
+}
+
+// CategoryRef names a category in a breadcrumb path.
+type CategoryRef struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// CategoryNode is a category with its subcategories, as returned by the
+// category tree.
+type CategoryNode struct {
+	Category
+	Children []CategoryNode `json:"children"`
+}
+
+// CategoryDeleteOptions say what happens to the products and subcategories of
+// a deleted category: they move to ReassignTo, or with Cascade they are
+// deleted along with it. Without either, a category still in use is kept.
+type CategoryDeleteOptions struct {
+	ReassignTo string
+	Cascade    bool
 }
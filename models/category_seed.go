@@ -0,0 +1,28 @@
+package models
+
+// CategorySeed is one category of a seed file. A seed file is the
+// categories.json format: a JSON object mapping each category ID to its
+// CategorySeed. Slug and ParentID are optional.
+type CategorySeed struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Slug        string `json:"slug,omitempty"`
+	Description string `json:"description"`
+	ParentID    string `json:"parent_id,omitempty"`
+}
+
+// CategoryImportError reports why one category of a seed file was rejected.
+type CategoryImportError struct {
+	ID      string `json:"id"`
+	Message string `json:"message"`
+}
+
+// CategoryImportResult summarizes a category seed import. In a dry run
+// nothing is written and Created/Updated report what a real import would do.
+type CategoryImportResult struct {
+	DryRun  bool                  `json:"dry_run"`
+	Total   int                   `json:"total"`
+	Created int                   `json:"created"`
+	Updated int                   `json:"updated"`
+	Errors  []CategoryImportError `json:"errors"`
+}
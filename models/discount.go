@@ -0,0 +1,98 @@
+package models
+
+import (
+	"sort"
+	"time"
+)
+
+// Discount types
+const (
+	DiscountPercentage = "percentage"
+	DiscountFixed      = "fixed"
+)
+
+// Discount scopes
+const (
+	DiscountScopeLine = "line"
+	DiscountScopeCart = "cart"
+)
+
+// Discount takes Value percent, or a fixed Value in rupiah, off an amount.
+type Discount struct {
+	Type  string `json:"type"`
+	Value int    `json:"value"`
+}
+
+// Amount returns what the discount takes off base: Value percent of it,
+// rounded down, or Value itself, but never more than base.
+func (d Discount) Amount(base int) int {
+	amount := d.Value
+	if d.Type == DiscountPercentage {
+		amount = base * d.Value / 100
+	}
+	if amount > base {
+		return base
+	}
+	return amount
+}
+
+// SpreadDiscount splits a cart discount over the lines in proportion to
+// their amounts after line discounts. Shares are rounded down and the units
+// left over go to the lines with the largest remainders, so the shares add
+// up to total and no line is discounted below zero.
+func SpreadDiscount(total int, amounts []int) []int {
+	shares := make([]int, len(amounts))
+	var sum int
+	for _, amount := range amounts {
+		sum += amount
+	}
+	if total == 0 || sum == 0 {
+		return shares
+	}
+
+	remainders := make([]int, len(amounts))
+	order := make([]int, len(amounts))
+	left := total
+	for i, amount := range amounts {
+		shares[i] = total * amount / sum
+		remainders[i] = total * amount % sum
+		order[i] = i
+		left -= shares[i]
+	}
+	sort.SliceStable(order, func(a, b int) bool { return remainders[order[a]] > remainders[order[b]] })
+	for _, i := range order[:left] {
+		shares[i]++
+	}
+	return shares
+}
+
+// AppliedDiscount is a discount given at checkout, on one line or on the
+// whole cart. Cart discounts come from the request or from a promo code, in
+// which case PromoCodeID and Code identify it.
+type AppliedDiscount struct {
+	ID                  int    `json:"id"`
+	TransactionDetailID int    `json:"transaction_detail_id,omitempty"`
+	Scope               string `json:"scope"`
+	PromoCodeID         int    `json:"promo_code_id,omitempty"`
+	Code                string `json:"code,omitempty"`
+	Discount
+	Amount int `json:"amount"`
+}
+
+// PromoCode is a cart discount customers redeem by code. It can only be used
+// while Active, from StartsAt until EndsAt when they are set, on carts of at
+// least MinSpend after line discounts, and at most UsageLimit times unless
+// that is 0. UsedCount is maintained by checkouts and voids.
+type PromoCode struct {
+	ID          int        `json:"id"`
+	Code        string     `json:"code"`
+	Description string     `json:"description"`
+	Discount    Discount   `json:"discount"`
+	MinSpend    int        `json:"min_spend"`
+	StartsAt    *time.Time `json:"starts_at,omitempty"`
+	EndsAt      *time.Time `json:"ends_at,omitempty"`
+	UsageLimit  int        `json:"usage_limit"`
+	UsedCount   int        `json:"used_count"`
+	Active      bool       `json:"active"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
@@ -0,0 +1,17 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// IdempotencyKey is a stored Idempotency-Key with the outcome of the request
+// that first used it. StatusCode is 0 while that request is still running.
+type IdempotencyKey struct {
+	Key         string          `json:"key"`
+	RequestHash string          `json:"request_hash"`
+	StatusCode  int             `json:"status_code"`
+	Response    json.RawMessage `json:"response"`
+	CreatedAt   time.Time       `json:"created_at"`
+	ExpiresAt   time.Time       `json:"expires_at"`
+}
@@ -0,0 +1,32 @@
+package models
+
+// ImportRow is one product read from an import file. Line is the 1-based
+// line (CSV) or array element (JSON) it came from. Fields holds the columns
+// (CSV) or keys (JSON) the row gave; the others keep their current value
+// when the row updates a product.
+type ImportRow struct {
+	Line   int
+	Produk Produk
+	Fields map[string]bool
+}
+
+// Has reports whether the row gave field.
+func (r ImportRow) Has(field string) bool {
+	return r.Fields[field]
+}
+
+// ImportRowError reports why one row of an import was rejected.
+type ImportRowError struct {
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+// ImportResult summarizes a product import. In a dry run nothing is written
+// and Created/Updated report what a real import would do.
+type ImportResult struct {
+	DryRun  bool             `json:"dry_run"`
+	Total   int              `json:"total"`
+	Created int              `json:"created"`
+	Updated int              `json:"updated"`
+	Errors  []ImportRowError `json:"errors"`
+}
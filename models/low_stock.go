@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// LowStockItem is a product, or a variant of it, whose stock is at or below
+// the product's reorder point.
+type LowStockItem struct {
+	ProductID    int    `json:"product_id"`
+	VariantID    int    `json:"variant_id,omitempty"`
+	Nama         string `json:"nama"`
+	VariantName  string `json:"variant_name,omitempty"`
+	SKU          string `json:"sku,omitempty"`
+	CategoryID   string `json:"category_id,omitempty"`
+	Stok         int    `json:"stok"`
+	ReorderPoint int    `json:"reorder_point"`
+}
+
+// LowStockAlert is raised when a sale takes items down to or below their
+// reorder point. Items only lists the ones that crossed it with this sale.
+type LowStockAlert struct {
+	TransactionID int            `json:"transaction_id"`
+	Items         []LowStockItem `json:"items"`
+	CreatedAt     time.Time      `json:"created_at"`
+}
@@ -0,0 +1,54 @@
+package models
+
+import "math"
+
+// MarginPercent returns profit as a percentage of revenue, rounded to two
+// decimals. It is 0 when there is no revenue.
+func MarginPercent(profit, revenue int) float64 {
+	if revenue == 0 {
+		return 0
+	}
+	return math.Round(float64(profit)*10000/float64(revenue)) / 100
+}
+
+// GrossProfit is revenue less the cost of goods sold (COGS).
+type GrossProfit struct {
+	Revenue       int     `json:"revenue"`
+	COGS          int     `json:"cogs"`
+	GrossProfit   int     `json:"gross_profit"`
+	MarginPercent float64 `json:"margin_percent"`
+}
+
+// NewGrossProfit derives the gross profit and margin of revenue and cogs.
+func NewGrossProfit(revenue, cogs int) GrossProfit {
+	return GrossProfit{
+		Revenue:       revenue,
+		COGS:          cogs,
+		GrossProfit:   revenue - cogs,
+		MarginPercent: MarginPercent(revenue-cogs, revenue),
+	}
+}
+
+// ProductGrossProfit is the gross profit of one product over a period.
+type ProductGrossProfit struct {
+	ProductID  int    `json:"product_id"`
+	Nama       string `json:"nama"`
+	QtyTerjual int    `json:"qty_terjual"`
+	GrossProfit
+}
+
+// CategoryGrossProfit is the gross profit of one category over a period.
+// Products without a category are grouped under an empty CategoryID.
+type CategoryGrossProfit struct {
+	CategoryID string `json:"category_id"`
+	Name       string `json:"name"`
+	GrossProfit
+}
+
+// GrossProfitReport breaks the gross profit of a period down per product and
+// per category, each sorted by gross profit, highest first.
+type GrossProfitReport struct {
+	GrossProfit
+	PerProduk   []ProductGrossProfit  `json:"per_produk"`
+	PerKategori []CategoryGrossProfit `json:"per_kategori"`
+}
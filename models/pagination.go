@@ -0,0 +1,57 @@
+package models
+
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 500
+)
+
+// Pagination selects one page of a list endpoint. Page is 1-based.
+type Pagination struct {
+	Page  int
+	Limit int
+}
+
+// Normalize applies the default page size and clamps out-of-range values.
+func (p *Pagination) Normalize() {
+	if p.Page < 1 {
+		p.Page = 1
+	}
+	if p.Limit <= 0 {
+		p.Limit = DefaultPageSize
+	}
+	if p.Limit > MaxPageSize {
+		p.Limit = MaxPageSize
+	}
+}
+
+// Offset returns the number of rows to skip for the page.
+func (p Pagination) Offset() int {
+	return (p.Page - 1) * p.Limit
+}
+
+// ProductFilter narrows, sorts and pages the product listing. Empty strings
+// and nil bounds disable the corresponding filter. IncludeDescendants widens
+// CategoryID to every category nested below it. Soft deleted products are
+// only listed with IncludeDeleted. Sort is a comma separated
+// list of fields, each optionally prefixed with "-" for descending order.
+type ProductFilter struct {
+	Name               string
+	CategoryID         string
+	IncludeDescendants bool
+	SKU                string
+	MinHarga           *int
+	MaxHarga           *int
+	MinStok            *int
+	MaxStok            *int
+	IncludeDeleted     bool
+	Sort               string
+	Pagination
+}
+
+// CategoryFilter narrows, sorts and pages the category listing.
+type CategoryFilter struct {
+	Name           string
+	IncludeDeleted bool
+	Sort           string
+	Pagination
+}
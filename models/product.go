@@ -1,8 +1,45 @@
 package models
 
+import "time"
+
+// Produk is a sellable product. SKU is an optional unique stock keeping code
+// and Barcodes lists every code a scanner may read for the product.
+// OptionAxes names the options (size, color, ...) its Variants set; a product
+// that has variants is sold through them, at their own price and stock.
+// HargaPokok is the cost price; Margin and MarginPercent are derived from it
+// and Harga. The product, or each of its variants, is low on stock once its
+// stock is at or below ReorderPoint; 0 disables low-stock alerts.
+// TaxRateID is the tax rate the product is sold at; 0 inherits the rate of
+// its category, or the default rate.
+// DeletedAt is set once the product has been soft deleted.
 type Produk struct {
-	ID    int    `json:"id"`
-	Nama  string `json:"nama"`
-	Harga int    `json:"harga"`
-	Stok  int    `json:"stok"`
+	ID           int              `json:"id"`
+	Nama         string           `json:"nama"`
+	Harga        int              `json:"harga"`
+	HargaPokok   int              `json:"harga_pokok"`
+	Margin       int              `json:"margin"`
+	MarginPct    float64          `json:"margin_percent"`
+	Stok         int              `json:"stok"`
+	ReorderPoint int              `json:"reorder_point"`
+	CategoryID   string           `json:"category_id,omitempty"`
+	TaxRateID    int              `json:"tax_rate_id,omitempty"`
+	SKU          string           `json:"sku,omitempty"`
+	Barcodes     []string         `json:"barcodes,omitempty"`
+	OptionAxes   []string         `json:"option_axes,omitempty"`
+	Variants     []ProductVariant `json:"variants,omitempty"`
+	DeletedAt    *time.Time       `json:"deleted_at,omitempty"`
+}
+
+// SetMargin derives Margin and MarginPct from Harga and HargaPokok.
+func (p *Produk) SetMargin() {
+	p.Margin = p.Harga - p.HargaPokok
+	p.MarginPct = MarginPercent(p.Margin, p.Harga)
+}
+
+// ProdukUpdate is the body of a product update. Stock only changes through
+// stock movements, so Stok is nil when left out and otherwise must repeat
+// the current stock.
+type ProdukUpdate struct {
+	Produk
+	Stok *int `json:"stok"`
 }
@@ -2,13 +2,44 @@ package models
 
 // BestSellingProduct represents the best selling product info
 type BestSellingProduct struct {
-	Nama      string `json:"nama"`
+	Nama       string `json:"nama"`
 	QtyTerjual int    `json:"qty_terjual"`
 }
 
-// DailyReportResponse represents the daily sales report
+// SalesBreakdown splits the sales of a period into gross sales at list
+// price, the discounts given and the net sales after discounts, before any
+// exclusive tax. Refunds are taken out of all three.
+type SalesBreakdown struct {
+	GrossSales int `json:"gross_sales"`
+	Discounts  int `json:"discounts"`
+	NetSales   int `json:"net_sales"`
+}
+
+// DailyReportResponse represents the daily sales report. TotalRevenue is
+// what was charged, tax included, net of refunds; the tax itself is
+// reported under Pajak.
 type DailyReportResponse struct {
 	TotalRevenue   int                `json:"total_revenue"`
 	TotalTransaksi int                `json:"total_transaksi"`
+	Penjualan      SalesBreakdown     `json:"penjualan"`
+	Pajak          TaxReport          `json:"pajak"`
 	ProdukTerlaris BestSellingProduct `json:"produk_terlaris"`
-}
\ No newline at end of file
+	LabaKotor      GrossProfitReport  `json:"laba_kotor"`
+}
+
+// DailySales is one day of the per-day breakdown series
+type DailySales struct {
+	Tanggal        string `json:"tanggal"`
+	TotalRevenue   int    `json:"total_revenue"`
+	TotalTransaksi int    `json:"total_transaksi"`
+}
+
+// SalesReportResponse represents the sales report for an arbitrary period.
+// The totals keep the DailyReportResponse shape; Harian has one entry per
+// day of the period, including days without sales.
+type SalesReportResponse struct {
+	StartDate string `json:"start_date"`
+	EndDate   string `json:"end_date"`
+	DailyReportResponse
+	Harian []DailySales `json:"harian"`
+}
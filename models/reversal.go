@@ -0,0 +1,88 @@
+package models
+
+import "time"
+
+// Transaction statuses
+const (
+	TransactionCompleted         = "completed"
+	TransactionPartiallyRefunded = "partially_refunded"
+	TransactionRefunded          = "refunded"
+	TransactionVoided            = "voided"
+)
+
+// Reversal types
+const (
+	ReversalVoid   = "void"
+	ReversalRefund = "refund"
+)
+
+// ReasonCodes lists the accepted reason codes for voids and refunds
+var ReasonCodes = map[string]bool{
+	"customer_return": true,
+	"damaged":         true,
+	"wrong_item":      true,
+	"cashier_error":   true,
+	"price_dispute":   true,
+	"other":           true,
+}
+
+// Reversal represents a void or refund linked to an earlier transaction.
+// TaxAmount is the tax contained in the refunded Amount.
+type Reversal struct {
+	ID            int            `json:"id"`
+	TransactionID int            `json:"transaction_id"`
+	Type          string         `json:"type"`
+	ReasonCode    string         `json:"reason_code"`
+	Note          string         `json:"note"`
+	Amount        int            `json:"amount"`
+	TaxAmount     int            `json:"tax_amount"`
+	CreatedAt     time.Time      `json:"created_at"`
+	Items         []ReversalItem `json:"items"`
+}
+
+// ReversalItem is the returned quantity of a single transaction line
+type ReversalItem struct {
+	ID                  int    `json:"id"`
+	ReversalID          int    `json:"reversal_id"`
+	TransactionDetailID int    `json:"transaction_detail_id"`
+	ProductID           int    `json:"product_id"`
+	ProductName         string `json:"product_name"`
+	VariantID           int    `json:"variant_id,omitempty"`
+	VariantName         string `json:"variant_name,omitempty"`
+	Quantity            int    `json:"quantity"`
+	Amount              int    `json:"amount"`
+	TaxAmount           int    `json:"tax_amount"`
+}
+
+// RefundShare returns the part of a line's total, an amount or its tax,
+// refunded for quantity of its units, when refundedQuantity units worth
+// refunded were returned before. Shares are prorated and rounded down; the
+// last units returned take whatever is left, so rounding never over- or
+// under-refunds a line.
+func RefundShare(total, lineQuantity, refundedQuantity, refunded, quantity int) int {
+	if quantity == lineQuantity-refundedQuantity {
+		return total - refunded
+	}
+	return total * quantity / lineQuantity
+}
+
+// VoidRequest represents the request body for voiding a transaction
+type VoidRequest struct {
+	ReasonCode string `json:"reason_code"`
+	Note       string `json:"note"`
+	Actor      string `json:"-"`
+}
+
+// RefundItem is a line to return in a refund request
+type RefundItem struct {
+	TransactionDetailID int `json:"transaction_detail_id"`
+	Quantity            int `json:"quantity"`
+}
+
+// RefundRequest represents the request body for refunding transaction lines
+type RefundRequest struct {
+	ReasonCode string       `json:"reason_code"`
+	Note       string       `json:"note"`
+	Items      []RefundItem `json:"items"`
+	Actor      string       `json:"-"`
+}
@@ -0,0 +1,61 @@
+package models
+
+import "time"
+
+// Stock movement types
+const (
+	StockInitial     = "initial"
+	StockSale        = "sale"
+	StockRefund      = "refund"
+	StockVoid        = "void"
+	StockAdjustment  = "adjustment"
+	StockReceiving   = "receiving"
+	StockTransferIn  = "transfer_in"
+	StockTransferOut = "transfer_out"
+	StockImport      = "import"
+)
+
+// StockAdjustmentTypes lists the movement types that can be recorded by hand.
+// Every other type is written by the operation that changes the stock.
+var StockAdjustmentTypes = map[string]bool{
+	StockAdjustment:  true,
+	StockReceiving:   true,
+	StockTransferIn:  true,
+	StockTransferOut: true,
+}
+
+// StockMovement is one entry of the append-only stock ledger. Quantity is the
+// signed change and StokAfter the balance of the product, or of the variant
+// when VariantID is set, right after it.
+type StockMovement struct {
+	ID        int64     `json:"id"`
+	ProductID int       `json:"product_id"`
+	VariantID int       `json:"variant_id,omitempty"`
+	Type      string    `json:"type"`
+	Quantity  int       `json:"quantity"`
+	StokAfter int       `json:"stok_after"`
+	Reason    string    `json:"reason"`
+	Reference string    `json:"reference"`
+	Actor     string    `json:"actor"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// StockAdjustmentRequest records a manual stock change. Quantity is signed for
+// adjustments; receiving and transfers take a positive number of units and
+// the type decides the direction. Actor is set from the X-Actor header.
+type StockAdjustmentRequest struct {
+	VariantID int    `json:"variant_id,omitempty"`
+	Type      string `json:"type"`
+	Quantity  int    `json:"quantity"`
+	Reason    string `json:"reason"`
+	Reference string `json:"reference"`
+	Actor     string `json:"-"`
+}
+
+// StockMovementFilter selects the ledger entries of one product.
+type StockMovementFilter struct {
+	ProductID int
+	VariantID int
+	Type      string
+	Pagination
+}
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"math"
+	"time"
+)
+
+// TaxRate is a tax such as PPN, charged at Rate percent. Prices of products
+// taxed at an Inclusive rate already contain the tax; exclusive rates are
+// added on top at checkout. Products use their own rate, else the rate of
+// their nearest category that has one, else the Default rate, if any.
+type TaxRate struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	Rate      float64   `json:"rate"`
+	Inclusive bool      `json:"inclusive"`
+	Default   bool      `json:"is_default"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Tax returns the tax on amount, rounded to the nearest rupiah: the share of
+// amount that is tax for inclusive rates, or Rate percent of it for
+// exclusive ones.
+func (t TaxRate) Tax(amount int) int {
+	bps := int64(math.Round(t.Rate * 100))
+	if bps <= 0 || amount <= 0 {
+		return 0
+	}
+	divisor := int64(10000)
+	if t.Inclusive {
+		divisor += bps
+	}
+	return int((int64(amount)*bps*2 + divisor) / (divisor * 2))
+}
+
+// TaxSummary is the tax collected at one rate over a period. TaxableAmount
+// is the sales the tax was charged on, excluding the tax itself.
+type TaxSummary struct {
+	Name          string  `json:"name"`
+	Rate          float64 `json:"rate"`
+	Inclusive     bool    `json:"inclusive"`
+	TaxableAmount int     `json:"taxable_amount"`
+	TaxAmount     int     `json:"tax_amount"`
+}
+
+// TaxReport totals the tax collected over a period, with a breakdown per
+// rate. Refunds are taken out of it.
+type TaxReport struct {
+	TaxableAmount int          `json:"taxable_amount"`
+	TaxAmount     int          `json:"tax_amount"`
+	PerTarif      []TaxSummary `json:"per_tarif"`
+}
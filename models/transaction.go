@@ -2,35 +2,114 @@ package models
 
 import "time"
 
-// Transaction represents a completed checkout transaction
+// Transaction represents a completed checkout transaction. TotalAmount is
+// what was charged: GrossAmount, the undiscounted sum of the lines, less
+// DiscountAmount, plus any exclusive tax. TaxAmount is all the tax charged,
+// inclusive or not. PromoCode is the promo code redeemed, if any.
 type Transaction struct {
-	ID          int       `json:"id"`
-	TotalAmount int       `json:"total_amount"`
-	CreatedAt   time.Time `json:"created_at"`
+	ID             int       `json:"id"`
+	GrossAmount    int       `json:"gross_amount"`
+	DiscountAmount int       `json:"discount_amount"`
+	TaxAmount      int       `json:"tax_amount"`
+	TotalAmount    int       `json:"total_amount"`
+	PromoCode      string    `json:"promo_code,omitempty"`
+	Status         string    `json:"status"`
+	CreatedAt      time.Time `json:"created_at"`
 }
 
-// TransactionDetail represents a single item in a transaction
+// TransactionDetail represents a single item in a transaction. Product and
+// variant names, unit price, unit cost and discount are snapshotted at sale
+// time; ProductID and VariantID are 0 once the product or variant has been
+// deleted. Discount covers the line's own discount and its share of any cart
+// discounts, so Subtotal is UnitPrice * Quantity - Discount. TaxAmount is the
+// tax on Subtotal at the snapshotted tax rate, and Total, what was charged
+// for the line, is Subtotal plus TaxAmount when the rate is exclusive.
 type TransactionDetail struct {
-	ID            int `json:"id"`
-	TransactionID int `json:"transaction_id"`
-	ProductID     int `json:"product_id"`
-	Quantity      int `json:"quantity"`
-	Subtotal      int `json:"subtotal"`
+	ID            int     `json:"id"`
+	TransactionID int     `json:"transaction_id"`
+	ProductID     int     `json:"product_id"`
+	ProductName   string  `json:"product_name"`
+	VariantID     int     `json:"variant_id,omitempty"`
+	VariantName   string  `json:"variant_name,omitempty"`
+	UnitPrice     int     `json:"unit_price"`
+	UnitCost      int     `json:"unit_cost"`
+	Quantity      int     `json:"quantity"`
+	Discount      int     `json:"discount"`
+	Subtotal      int     `json:"subtotal"`
+	TaxRateID     int     `json:"tax_rate_id,omitempty"`
+	TaxName       string  `json:"tax_name,omitempty"`
+	TaxRate       float64 `json:"tax_rate"`
+	TaxInclusive  bool    `json:"tax_inclusive"`
+	TaxAmount     int     `json:"tax_amount"`
+	Total         int     `json:"total"`
 }
 
-// CheckoutItem represents a single item in the checkout request
+// SetTax taxes the line's Subtotal at rate, recording the rate, and sets
+// Total, which adds the tax when the rate is exclusive.
+func (d *TransactionDetail) SetTax(rate TaxRate) {
+	d.TaxRateID = rate.ID
+	d.TaxName = rate.Name
+	d.TaxRate = rate.Rate
+	d.TaxInclusive = rate.Inclusive
+	d.TaxAmount = rate.Tax(d.Subtotal)
+	d.Total = d.Subtotal
+	if !rate.Inclusive {
+		d.Total += d.TaxAmount
+	}
+}
+
+// CheckoutItem represents a single item in the checkout request. The product
+// is identified either by ProductID or by a scanned Barcode; products with
+// variants also need the VariantID being sold.
 type CheckoutItem struct {
-	ProductID int `json:"product_id"`
-	Quantity  int `json:"quantity"`
+	ProductID int       `json:"product_id,omitempty"`
+	VariantID int       `json:"variant_id,omitempty"`
+	Barcode   string    `json:"barcode,omitempty"`
+	Quantity  int       `json:"quantity"`
+	Discount  *Discount `json:"discount,omitempty"`
 }
 
-// CheckoutRequest represents the request body for checkout
+// CheckoutRequest represents the request body for checkout. Item discounts
+// apply first; Discount and then PromoCode are taken off what remains.
 type CheckoutRequest struct {
-	Items []CheckoutItem `json:"items"`
+	Items     []CheckoutItem `json:"items"`
+	Discount  *Discount      `json:"discount,omitempty"`
+	PromoCode string         `json:"promo_code,omitempty"`
+	Actor     string         `json:"-"`
 }
 
 // CheckoutResponse represents the response after successful checkout
 type CheckoutResponse struct {
 	Transaction Transaction         `json:"transaction"`
 	Details     []TransactionDetail `json:"details"`
-}
\ No newline at end of file
+	Discounts   []AppliedDiscount   `json:"discounts"`
+}
+
+// TransactionFilter narrows the transaction history listing. Zero values
+// disable the corresponding filter. Handlers set StartDate and EndDate to
+// inclusive business dates; the service turns them into the instants
+// bounding the half-open range the repository queries.
+type TransactionFilter struct {
+	StartDate time.Time
+	EndDate   time.Time
+	MinAmount int
+	MaxAmount int
+	ProductID int
+	AfterID   int // cursor: only transactions older than this ID
+	Limit     int
+}
+
+// TransactionListResponse is one page of the transaction history
+type TransactionListResponse struct {
+	Data       []Transaction `json:"data"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+}
+
+// TransactionDetailResponse represents a past transaction with its line items
+// and any voids or refunds made against it
+type TransactionDetailResponse struct {
+	Transaction Transaction         `json:"transaction"`
+	Details     []TransactionDetail `json:"details"`
+	Discounts   []AppliedDiscount   `json:"discounts"`
+	Reversals   []Reversal          `json:"reversals"`
+}
@@ -0,0 +1,32 @@
+package models
+
+import "strings"
+
+// ProductVariant is one option combination of a product, such as size L in
+// red. It is sold and stocked independently of its parent product.
+type ProductVariant struct {
+	ID         int               `json:"id"`
+	ProductID  int               `json:"product_id"`
+	SKU        string            `json:"sku,omitempty"`
+	Options    map[string]string `json:"options"`
+	Harga      int               `json:"harga"`
+	HargaPokok int               `json:"harga_pokok"`
+	Margin     int               `json:"margin"`
+	MarginPct  float64           `json:"margin_percent"`
+	Stok       int               `json:"stok"`
+}
+
+// SetMargin derives Margin and MarginPct from Harga and HargaPokok.
+func (v *ProductVariant) SetMargin() {
+	v.Margin = v.Harga - v.HargaPokok
+	v.MarginPct = MarginPercent(v.Margin, v.Harga)
+}
+
+// Name joins the option values in axes order, e.g. "L / Merah".
+func (v ProductVariant) Name(axes []string) string {
+	values := make([]string, 0, len(axes))
+	for _, axis := range axes {
+		values = append(values, v.Options[axis])
+	}
+	return strings.Join(values, " / ")
+}
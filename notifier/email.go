@@ -0,0 +1,42 @@
+package notifier
+
+import (
+	"category-api/models"
+	"fmt"
+	"net/smtp"
+	"strings"
+)
+
+type emailNotifier struct {
+	addr string
+	from string
+	to   []string
+}
+
+// NewEmailNotifier returns a notifier mailing alerts through the SMTP relay
+// at addr, typically a local one that needs no authentication.
+func NewEmailNotifier(addr, from string, to []string) Notifier {
+	return &emailNotifier{addr: addr, from: from, to: to}
+}
+
+func (n *emailNotifier) NotifyLowStock(alert models.LowStockAlert) error {
+	subject := fmt.Sprintf("Low stock: %d item(s) at or below reorder point", len(alert.Items))
+	body := fmt.Sprintf("Transaction %d on %s took these items to or below their reorder point:\n\n%s\n",
+		alert.TransactionID, alert.CreatedAt.Format("2006-01-02 15:04 MST"), strings.Join(describeLowStock(alert), "\n"))
+	return n.send(subject, body)
+}
+
+func (n *emailNotifier) send(subject, body string) error {
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", n.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(n.to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+
+	if err := smtp.SendMail(n.addr, nil, n.from, n.to, []byte(msg.String())); err != nil {
+		return fmt.Errorf("email to %s: %w", strings.Join(n.to, ", "), err)
+	}
+	return nil
+}
@@ -0,0 +1,20 @@
+package notifier
+
+import (
+	"category-api/models"
+	"log"
+)
+
+type logNotifier struct{}
+
+// NewLogNotifier returns a notifier writing alerts to the standard logger.
+func NewLogNotifier() Notifier {
+	return logNotifier{}
+}
+
+func (logNotifier) NotifyLowStock(alert models.LowStockAlert) error {
+	for _, line := range describeLowStock(alert) {
+		log.Printf("Low stock after transaction %d: %s", alert.TransactionID, line)
+	}
+	return nil
+}
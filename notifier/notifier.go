@@ -0,0 +1,89 @@
+// Package notifier delivers operational alerts, such as products running low
+// on stock, through pluggable channels.
+package notifier
+
+import (
+	"category-api/models"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Channels accepted in Config.Channels.
+const (
+	ChannelLog     = "log"
+	ChannelWebhook = "webhook"
+	ChannelEmail   = "email"
+)
+
+// Notifier delivers alerts. Implementations must be safe for concurrent use.
+type Notifier interface {
+	NotifyLowStock(alert models.LowStockAlert) error
+}
+
+// Config selects the channels built by New and configures them.
+type Config struct {
+	Channels       []string
+	WebhookURL     string
+	WebhookTimeout time.Duration
+	SMTPAddr       string
+	EmailFrom      string
+	EmailTo        []string
+}
+
+// New builds a notifier delivering to every configured channel. No channels
+// gives a notifier that discards alerts.
+func New(cfg Config) (Notifier, error) {
+	var notifiers multi
+	for _, channel := range cfg.Channels {
+		switch strings.TrimSpace(channel) {
+		case "":
+		case ChannelLog:
+			notifiers = append(notifiers, NewLogNotifier())
+		case ChannelWebhook:
+			if cfg.WebhookURL == "" {
+				return nil, errors.New("webhook notifier needs a URL")
+			}
+			notifiers = append(notifiers, NewWebhookNotifier(cfg.WebhookURL, cfg.WebhookTimeout))
+		case ChannelEmail:
+			if cfg.SMTPAddr == "" || cfg.EmailFrom == "" || len(cfg.EmailTo) == 0 {
+				return nil, errors.New("email notifier needs an SMTP address, a sender and recipients")
+			}
+			notifiers = append(notifiers, NewEmailNotifier(cfg.SMTPAddr, cfg.EmailFrom, cfg.EmailTo))
+		default:
+			return nil, fmt.Errorf("unknown notifier %q", channel)
+		}
+	}
+	return notifiers, nil
+}
+
+// multi fans every alert out to all of its notifiers, so one failing channel
+// does not keep the others from delivering.
+type multi []Notifier
+
+func (m multi) NotifyLowStock(alert models.LowStockAlert) error {
+	var errs []error
+	for _, n := range m {
+		if err := n.NotifyLowStock(alert); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// describeLowStock renders one line per item for the text channels.
+func describeLowStock(alert models.LowStockAlert) []string {
+	lines := make([]string, len(alert.Items))
+	for i, item := range alert.Items {
+		name := item.Nama
+		if item.VariantName != "" {
+			name += " (" + item.VariantName + ")"
+		}
+		if item.SKU != "" {
+			name += " [" + item.SKU + "]"
+		}
+		lines[i] = fmt.Sprintf("%s: %d left, reorder point %d", name, item.Stok, item.ReorderPoint)
+	}
+	return lines
+}
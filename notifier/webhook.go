@@ -0,0 +1,54 @@
+package notifier
+
+import (
+	"bytes"
+	"category-api/models"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// defaultWebhookTimeout bounds a webhook delivery when no timeout is configured.
+const defaultWebhookTimeout = 10 * time.Second
+
+// webhookPayload is the JSON body posted for every alert. Event tells
+// receivers which kind of alert Data holds.
+type webhookPayload struct {
+	Event string      `json:"event"`
+	Data  interface{} `json:"data"`
+}
+
+type webhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookNotifier returns a notifier posting alerts as JSON to url. Any
+// status other than 2xx counts as a failed delivery.
+func NewWebhookNotifier(url string, timeout time.Duration) Notifier {
+	if timeout <= 0 {
+		timeout = defaultWebhookTimeout
+	}
+	return &webhookNotifier{url: url, client: &http.Client{Timeout: timeout}}
+}
+
+func (n *webhookNotifier) NotifyLowStock(alert models.LowStockAlert) error {
+	return n.post(webhookPayload{Event: "low_stock", Data: alert})
+}
+
+func (n *webhookNotifier) post(payload webhookPayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	resp, err := n.client.Post(n.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("webhook %s: %w", payload.Event, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook %s: unexpected status %s", payload.Event, resp.Status)
+	}
+	return nil
+}
@@ -3,14 +3,21 @@ package repositories
 import (
 	"category-api/models"
 	"database/sql"
+	"fmt"
 )
 
 type CategoryRepository interface {
-	GetAll() ([]models.Category, error)
+	GetAll(filter models.CategoryFilter) ([]models.Category, int, error)
+	Each(filter models.CategoryFilter, fn func(models.Category) error) error
 	GetByID(id string) (models.Category, error)
+	GetBySlug(slug string) (models.Category, error)
+	GetSlugs(base string) (map[string]bool, error)
 	Create(c models.Category) (models.Category, error)
 	Update(id string, c models.Category) (models.Category, error)
-	Delete(id string) error
+	Delete(id string, opts models.CategoryDeleteOptions) error
+	Restore(id string) (models.Category, error)
+	GetPath(id string) ([]models.CategoryRef, error)
+	Import(categories []models.Category) (created, updated int, err error)
 }
 
 type categoryRepository struct {
@@ -21,51 +28,352 @@ func NewCategoryRepository(db *sql.DB) CategoryRepository {
 	return &categoryRepository{db}
 }
 
-func (r *categoryRepository) GetAll() ([]models.Category, error) {
-	rows, err := r.db.Query("SELECT id, name, description FROM categories")
+// categorySelect returns categories together with the live number of products
+// linked to each of them.
+const categorySelect = `
+	SELECT c.id, c.name, c.slug, COALESCE(c.description, ''), COALESCE(c.parent_id, ''), COALESCE(c.tax_rate_id, 0), COUNT(p.id), c.deleted_at
+	FROM categories c
+	LEFT JOIN products p ON p.category_id = c.id AND p.deleted_at IS NULL`
+
+// categoryReturning is the RETURNING list of category writes, matching scanCategory.
+const categoryReturning = `id, name, slug, COALESCE(description, ''), COALESCE(parent_id, ''), COALESCE(tax_rate_id, 0),
+	(SELECT COUNT(*) FROM products p WHERE p.category_id = categories.id AND p.deleted_at IS NULL), deleted_at`
+
+// categoryGroupBy completes categorySelect after its WHERE clause.
+const categoryGroupBy = " GROUP BY c.id, c.name, c.slug, c.description, c.parent_id, c.tax_rate_id, c.deleted_at"
+
+func scanCategory(row rowScanner) (models.Category, error) {
+	var c models.Category
+	err := row.Scan(&c.ID, &c.Name, &c.Slug, &c.Description, &c.ParentID, &c.TaxRateID, &c.ProductCount, &c.DeletedAt)
+	return c, err
+}
+
+// categorySortColumns maps the sort fields accepted by GetAll to columns.
+var categorySortColumns = map[string]string{
+	"id":            "c.id",
+	"name":          "c.name",
+	"product_count": "COUNT(p.id)",
+}
+
+// categoryQuery builds the WHERE and ORDER BY clauses selecting the categories matching filter.
+func categoryQuery(filter models.CategoryFilter) (queryBuilder, string, error) {
+	var q queryBuilder
+	if !filter.IncludeDeleted {
+		q.conds = append(q.conds, "c.deleted_at IS NULL")
+	}
+	if filter.Name != "" {
+		q.where("c.name ILIKE '%' || $%d || '%'", filter.Name)
+	}
+
+	order, err := orderBy(filter.Sort, categorySortColumns, "c.name ASC", "c.id")
+	return q, order, err
+}
+
+// GetAll returns one page of the categories matching filter together with the
+// total number of matching categories.
+func (r *categoryRepository) GetAll(filter models.CategoryFilter) ([]models.Category, int, error) {
+	q, order, err := categoryQuery(filter)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
+	}
+
+	var total int
+	if err := r.db.QueryRow("SELECT COUNT(*) FROM categories c"+q.whereClause(), q.args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := categorySelect + q.whereClause() + categoryGroupBy + order +
+		" LIMIT " + q.arg(filter.Limit) + " OFFSET " + q.arg(filter.Offset())
+	rows, err := r.db.Query(query, q.args...)
+	if err != nil {
+		return nil, 0, err
 	}
 	defer rows.Close()
 
 	var categories []models.Category
 	for rows.Next() {
-		var c models.Category
-		if err := rows.Scan(&c.ID, &c.Name, &c.Description); err != nil {
-			return nil, err
+		c, err := scanCategory(rows)
+		if err != nil {
+			return nil, 0, err
 		}
 		categories = append(categories, c)
 	}
-	return categories, nil
+	return categories, total, rows.Err()
+}
+
+// Each calls fn for every category matching filter, ignoring its pagination,
+// as rows arrive from the database. It stops at the first error fn returns.
+func (r *categoryRepository) Each(filter models.CategoryFilter, fn func(models.Category) error) error {
+	q, order, err := categoryQuery(filter)
+	if err != nil {
+		return err
+	}
+	rows, err := r.db.Query(categorySelect+q.whereClause()+categoryGroupBy+order, q.args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		c, err := scanCategory(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(c); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
 }
 
 func (r *categoryRepository) GetByID(id string) (models.Category, error) {
-	var c models.Category
-	err := r.db.QueryRow("SELECT id, name, description FROM categories WHERE id = $1", id).
-		Scan(&c.ID, &c.Name, &c.Description)
-	return c, err
+	c, err := scanCategory(r.db.QueryRow(categorySelect+" WHERE c.id = $1 AND c.deleted_at IS NULL"+categoryGroupBy, id))
+	return c, mapError(err, ErrCategoryNotFound)
+}
+
+func (r *categoryRepository) GetBySlug(slug string) (models.Category, error) {
+	c, err := scanCategory(r.db.QueryRow(categorySelect+" WHERE c.slug = $1 AND c.deleted_at IS NULL"+categoryGroupBy, slug))
+	return c, mapError(err, ErrCategoryNotFound)
+}
+
+// GetSlugs returns the slugs already taken among base and its numbered
+// forms such as base-2, deleted categories included.
+func (r *categoryRepository) GetSlugs(base string) (map[string]bool, error) {
+	rows, err := r.db.Query("SELECT slug FROM categories WHERE slug = $1 OR slug LIKE $1 || '-%'", base)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	taken := make(map[string]bool)
+	for rows.Next() {
+		var slug string
+		if err := rows.Scan(&slug); err != nil {
+			return nil, err
+		}
+		taken[slug] = true
+	}
+	return taken, rows.Err()
 }
 
 func (r *categoryRepository) Create(c models.Category) (models.Category, error) {
 	// Assuming ID is passed from service (UUID) or generated here.
 	// The implementation plan says "Create Category" gets JSON.
 	// Since usage is uuid, we will insert the ID provided by struct.
-	_, err := r.db.Exec("INSERT INTO categories (id, name, description) VALUES ($1, $2, $3)",
-		c.ID, c.Name, c.Description)
-	return c, err
+	created, err := scanCategory(r.db.QueryRow(
+		"INSERT INTO categories (id, name, slug, description, parent_id, tax_rate_id) VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, 0)) RETURNING "+categoryReturning,
+		c.ID, c.Name, c.Slug, c.Description, c.ParentID, c.TaxRateID,
+	))
+	if err != nil {
+		return c, mapError(err, nil)
+	}
+	return created, nil
 }
 
+// Update replaces a category. A new parent is checked for cycles with the
+// category and the parent's ancestors locked, so concurrent moves cannot
+// close a loop between them.
 func (r *categoryRepository) Update(id string, c models.Category) (models.Category, error) {
-	_, err := r.db.Exec("UPDATE categories SET name = $1, description = $2 WHERE id = $3",
-		c.Name, c.Description, id)
+	var updated models.Category
+	err := runInTx(r.db, func(tx *sql.Tx) error {
+		var current string
+		err := tx.QueryRow("SELECT id FROM categories WHERE id = $1 AND deleted_at IS NULL FOR UPDATE", id).Scan(&current)
+		if err != nil {
+			return err
+		}
+		if err := checkCategoryCycle(tx, id, c.ParentID); err != nil {
+			return err
+		}
+		updated, err = scanCategory(tx.QueryRow(`
+			UPDATE categories SET name = $1, slug = COALESCE(NULLIF($2, ''), slug), description = $3, parent_id = NULLIF($4, ''),
+				tax_rate_id = NULLIF($5, 0)
+			WHERE id = $6
+			RETURNING `+categoryReturning,
+			c.Name, c.Slug, c.Description, c.ParentID, c.TaxRateID, id,
+		))
+		return err
+	})
 	if err != nil {
-		return c, err
+		return c, mapError(err, ErrCategoryNotFound)
+	}
+	return updated, nil
+}
+
+// checkCategoryCycle walks up from parentID, locking every category on the
+// way, deleted ones included, and fails with ErrCategoryCycle when it meets
+// id. Deleted categories count because restoring them would close the loop.
+func checkCategoryCycle(tx *sql.Tx, id, parentID string) error {
+	for ancestor, depth := parentID, 0; ancestor != "" && depth <= maxCategoryDepth; depth++ {
+		if ancestor == id {
+			return ErrCategoryCycle
+		}
+		var next sql.NullString
+		err := tx.QueryRow("SELECT parent_id FROM categories WHERE id = $1 FOR UPDATE", ancestor).Scan(&next)
+		if err != nil {
+			return mapError(err, ErrCategoryNotFound.WithMessage(fmt.Sprintf("category %q not found", ancestor)))
+		}
+		ancestor = next.String
 	}
-	c.ID = id
-	return c, nil
+	return nil
+}
+
+// Delete soft deletes a category. A category that still has products or
+// subcategories is only deleted when opts moves them, deleted products
+// included, to another category or cascades the delete to them; otherwise
+// it fails with ErrCategoryInUse. Products deleted earlier otherwise keep
+// their category_id so a restore brings the whole category back.
+func (r *categoryRepository) Delete(id string, opts models.CategoryDeleteOptions) error {
+	err := runInTx(r.db, func(tx *sql.Tx) error {
+		var products, subcategories int
+		err := tx.QueryRow(`
+			SELECT
+				(SELECT COUNT(*) FROM products p WHERE p.category_id = c.id AND p.deleted_at IS NULL),
+				(SELECT COUNT(*) FROM categories s WHERE s.parent_id = c.id AND s.deleted_at IS NULL)
+			FROM categories c WHERE c.id = $1 AND c.deleted_at IS NULL FOR UPDATE`,
+			id,
+		).Scan(&products, &subcategories)
+		if err != nil {
+			return mapError(err, ErrCategoryNotFound)
+		}
+
+		switch {
+		case opts.ReassignTo != "":
+			var target string
+			err := tx.QueryRow("SELECT id FROM categories WHERE id = $1 AND deleted_at IS NULL FOR SHARE", opts.ReassignTo).Scan(&target)
+			if err != nil {
+				return mapError(err, ErrCategoryNotFound.WithMessage("reassign_to category not found"))
+			}
+			// The subcategories, deleted ones included, move under the
+			// target, which must not itself sit below them
+			if err := checkCategoryCycle(tx, id, opts.ReassignTo); err != nil {
+				return err
+			}
+			if _, err := tx.Exec("UPDATE products SET category_id = $1 WHERE category_id = $2", opts.ReassignTo, id); err != nil {
+				return err
+			}
+			if _, err := tx.Exec("UPDATE categories SET parent_id = $1 WHERE parent_id = $2", opts.ReassignTo, id); err != nil {
+				return err
+			}
+		case opts.Cascade:
+			subtree := categoryDescendants("$1")
+			if _, err := tx.Exec("UPDATE products SET deleted_at = NOW() WHERE category_id IN "+subtree+" AND deleted_at IS NULL", id); err != nil {
+				return err
+			}
+			if _, err := tx.Exec("UPDATE categories SET deleted_at = NOW() WHERE id IN "+subtree+" AND id <> $1 AND deleted_at IS NULL", id); err != nil {
+				return err
+			}
+		case products > 0 || subcategories > 0:
+			return ErrCategoryInUse.WithDetails(map[string]int{"products": products, "subcategories": subcategories})
+		}
+
+		_, err = tx.Exec("UPDATE categories SET deleted_at = NOW() WHERE id = $1", id)
+		return err
+	})
+	return mapError(err, nil)
+}
+
+// Restore undoes a soft delete. Restoring a category that is not deleted
+// simply returns it. A category whose parents lead back to it is not
+// restored and fails with ErrCategoryCycle.
+func (r *categoryRepository) Restore(id string) (models.Category, error) {
+	var restored models.Category
+	err := runInTx(r.db, func(tx *sql.Tx) error {
+		var parentID sql.NullString
+		if err := tx.QueryRow("SELECT parent_id FROM categories WHERE id = $1 FOR UPDATE", id).Scan(&parentID); err != nil {
+			return err
+		}
+		if err := checkCategoryCycle(tx, id, parentID.String); err != nil {
+			return err
+		}
+		var err error
+		restored, err = scanCategory(tx.QueryRow("UPDATE categories SET deleted_at = NULL WHERE id = $1 RETURNING "+categoryReturning, id))
+		return err
+	})
+	return restored, mapError(err, ErrCategoryNotFound)
+}
+
+// maxCategoryDepth bounds how far the parent chain is walked, so a parent
+// cycle left in older data cannot make a query loop forever.
+const maxCategoryDepth = 100
+
+// GetPath returns the breadcrumb of a category: its ancestors from the root
+// down, followed by the category itself. A soft deleted ancestor ends the
+// path, making its child the root.
+func (r *categoryRepository) GetPath(id string) ([]models.CategoryRef, error) {
+	rows, err := r.db.Query(`
+		WITH RECURSIVE path AS (
+			SELECT id, name, parent_id, 0 AS depth FROM categories WHERE id = $1 AND deleted_at IS NULL
+			UNION ALL
+			SELECT c.id, c.name, c.parent_id, path.depth + 1
+			FROM categories c JOIN path ON c.id = path.parent_id
+			WHERE c.deleted_at IS NULL AND path.depth < $2
+		)
+		SELECT id, name FROM path ORDER BY depth DESC`,
+		id, maxCategoryDepth,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var path []models.CategoryRef
+	for rows.Next() {
+		var ref models.CategoryRef
+		if err := rows.Scan(&ref.ID, &ref.Name); err != nil {
+			return nil, err
+		}
+		path = append(path, ref)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(path) == 0 {
+		return nil, ErrCategoryNotFound
+	}
+	return path, nil
+}
+
+// Import upserts categories by ID in one transaction, in the given order, so
+// parents must come before their subcategories. Existing categories are
+// overwritten and restored if they were deleted.
+func (r *categoryRepository) Import(categories []models.Category) (created, updated int, err error) {
+	err = runInTx(r.db, func(tx *sql.Tx) error {
+		created, updated = 0, 0
+		for _, c := range categories {
+			var inserted bool
+			err := tx.QueryRow(`
+				INSERT INTO categories (id, name, slug, description, parent_id) VALUES ($1, $2, $3, $4, NULLIF($5, ''))
+				ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name, slug = EXCLUDED.slug, description = EXCLUDED.description,
+					parent_id = EXCLUDED.parent_id, deleted_at = NULL
+				RETURNING xmax = 0`,
+				c.ID, c.Name, c.Slug, c.Description, c.ParentID,
+			).Scan(&inserted)
+			if err != nil {
+				return mapError(err, nil)
+			}
+			if err := checkCategoryCycle(tx, c.ID, c.ParentID); err != nil {
+				return err
+			}
+			if inserted {
+				created++
+			} else {
+				updated++
+			}
+		}
+		return nil
+	})
+	return created, updated, err
 }
 
-func (r *categoryRepository) Delete(id string) error {
-	_, err := r.db.Exec("DELETE FROM categories WHERE id = $1", id)
-	return err
+// categoryDescendants returns a subquery selecting the ID of the category
+// bound to placeholder and of every category nested below it that is not
+// deleted.
+func categoryDescendants(placeholder string) string {
+	return `(
+		WITH RECURSIVE tree AS (
+			SELECT id FROM categories WHERE id = ` + placeholder + `
+			UNION
+			SELECT c.id FROM categories c JOIN tree ON c.parent_id = tree.id WHERE c.deleted_at IS NULL
+		)
+		SELECT id FROM tree)`
 }
@@ -0,0 +1,135 @@
+package repositories
+
+import (
+	"category-api/apperrors"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+var (
+	// ErrProductNotFound is returned when a product does not exist.
+	ErrProductNotFound = apperrors.NotFound("product_not_found", "product not found")
+	// ErrVariantNotFound is returned when a product variant does not exist.
+	ErrVariantNotFound = apperrors.NotFound("variant_not_found", "variant not found")
+	// ErrVariantRequired is returned when a product with variants is sold without choosing one.
+	ErrVariantRequired = apperrors.Unprocessable("variant_required", "product is sold by variant; variant_id is required")
+	// ErrCategoryNotFound is returned when a category does not exist.
+	ErrCategoryNotFound = apperrors.NotFound("category_not_found", "category not found")
+	// ErrCategoryInUse is returned when deleting a category that still has products or subcategories.
+	ErrCategoryInUse = apperrors.Conflict("category_in_use", "category still has products or subcategories; pass reassign_to or cascade=true")
+	// ErrCategoryCycle is returned when a write would nest a category under itself.
+	ErrCategoryCycle = apperrors.Unprocessable("category_cycle", "a category cannot be moved under itself or one of its subcategories")
+	// ErrPromoCodeNotFound is returned when a promo code does not exist.
+	ErrPromoCodeNotFound = apperrors.NotFound("promo_code_not_found", "promo code not found")
+	// ErrPromoCodeUnavailable is returned when a promo code is inactive, outside its validity window or used up.
+	ErrPromoCodeUnavailable = apperrors.Unprocessable("promo_code_unavailable", "promo code cannot be used")
+	// ErrPromoMinSpend is returned when a cart is below the minimum spend of its promo code.
+	ErrPromoMinSpend = apperrors.Unprocessable("promo_min_spend_not_met", "cart does not reach the promo code's minimum spend")
+	// ErrTaxRateNotFound is returned when a tax rate does not exist.
+	ErrTaxRateNotFound = apperrors.NotFound("tax_rate_not_found", "tax rate not found")
+	// ErrTransactionNotFound is returned when a transaction does not exist.
+	ErrTransactionNotFound = apperrors.NotFound("transaction_not_found", "transaction not found")
+	// ErrInsufficientStock is the code-level sentinel matched by every InsufficientStockError.
+	ErrInsufficientStock = apperrors.Conflict("insufficient_stock", "insufficient stock")
+	// ErrTransactionVoided is returned when reversing a transaction that has been voided.
+	ErrTransactionVoided = apperrors.Conflict("transaction_voided", "transaction has already been voided")
+	// ErrTransactionRefunded is returned when voiding a transaction that already has refunds.
+	ErrTransactionRefunded = apperrors.Conflict("transaction_refunded", "transaction has refunds and can no longer be voided")
+	// ErrInvalidRefund is returned when refund lines do not match what can still be returned.
+	ErrInvalidRefund = apperrors.Unprocessable("invalid_refund", "invalid refund")
+
+	// ErrDuplicate is returned when a write violates a unique constraint.
+	ErrDuplicate = apperrors.Conflict("duplicate", "a record with the same unique value already exists")
+	// ErrForeignKeyViolation is returned when a write references a missing
+	// record, or a delete would leave other records pointing at nothing.
+	ErrForeignKeyViolation = apperrors.Conflict("foreign_key_violation", "the operation conflicts with related records")
+)
+
+// PostgreSQL error codes, see https://www.postgresql.org/docs/current/errcodes-appendix.html
+const (
+	pqUniqueViolation     = "23505"
+	pqForeignKeyViolation = "23503"
+)
+
+// mapError translates driver errors into domain errors: sql.ErrNoRows
+// becomes notFound, and unique and foreign-key violations become
+// ErrDuplicate and ErrForeignKeyViolation with the constraint as details.
+// Any other error is returned unchanged.
+func mapError(err error, notFound *apperrors.Error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, sql.ErrNoRows) && notFound != nil {
+		return notFound
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		details := map[string]string{"constraint": pqErr.Constraint}
+		switch pqErr.Code {
+		case pqUniqueViolation:
+			return ErrDuplicate.WithDetails(details).Wrap(err)
+		case pqForeignKeyViolation:
+			return ErrForeignKeyViolation.WithDetails(details).Wrap(err)
+		}
+	}
+	return err
+}
+
+// checkAffected returns notFound when a write statement matched no rows.
+func checkAffected(res sql.Result, notFound *apperrors.Error) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return notFound
+	}
+	return nil
+}
+
+// StockShortage describes a product or variant that cannot cover the requested quantity.
+type StockShortage struct {
+	ProductID int    `json:"product_id"`
+	VariantID int    `json:"variant_id,omitempty"`
+	Nama      string `json:"nama"`
+	Requested int    `json:"requested"`
+	Available int    `json:"available"`
+}
+
+// InsufficientStockError lists every product in a checkout whose stock is too low.
+type InsufficientStockError struct {
+	Items []StockShortage
+}
+
+func (e *InsufficientStockError) Error() string {
+	names := make([]string, len(e.Items))
+	for i, item := range e.Items {
+		names[i] = item.Nama
+	}
+	return "insufficient stock for product: " + strings.Join(names, ", ")
+}
+
+// Unwrap exposes the error as an insufficient_stock application error whose
+// details list the short products.
+func (e *InsufficientStockError) Unwrap() error {
+	return ErrInsufficientStock.WithMessage(e.Error()).WithDetails(e.Items)
+}
+
+// RowError ties an error to the line of a bulk import that caused it.
+type RowError struct {
+	Line int
+	Err  error
+}
+
+func (e *RowError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *RowError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,76 @@
+package repositories
+
+import (
+	"category-api/models"
+	"database/sql"
+	"time"
+)
+
+type IdempotencyRepository interface {
+	Reserve(key string, requestHash string, expiresAt time.Time) (models.IdempotencyKey, bool, error)
+	Release(key string) error
+	DeleteExpired() (int64, error)
+}
+
+type idempotencyRepository struct {
+	db *sql.DB
+}
+
+func NewIdempotencyRepository(db *sql.DB) IdempotencyRepository {
+	return &idempotencyRepository{db}
+}
+
+// Reserve claims key for a new request. It returns true when the key was
+// claimed, or false together with the existing record when the key is
+// already in use. Expired keys are discarded before claiming.
+func (r *idempotencyRepository) Reserve(key string, requestHash string, expiresAt time.Time) (models.IdempotencyKey, bool, error) {
+	if _, err := r.db.Exec("DELETE FROM idempotency_keys WHERE key = $1 AND expires_at < NOW()", key); err != nil {
+		return models.IdempotencyKey{}, false, err
+	}
+
+	res, err := r.db.Exec(
+		"INSERT INTO idempotency_keys (key, request_hash, expires_at) VALUES ($1, $2, $3) ON CONFLICT (key) DO NOTHING",
+		key, requestHash, expiresAt,
+	)
+	if err != nil {
+		return models.IdempotencyKey{}, false, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return models.IdempotencyKey{}, false, err
+	} else if n == 1 {
+		return models.IdempotencyKey{Key: key, RequestHash: requestHash, ExpiresAt: expiresAt}, true, nil
+	}
+
+	var record models.IdempotencyKey
+	var response []byte
+	err = r.db.QueryRow(
+		"SELECT key, request_hash, COALESCE(status_code, 0), response, created_at, expires_at FROM idempotency_keys WHERE key = $1",
+		key,
+	).Scan(&record.Key, &record.RequestHash, &record.StatusCode, &response, &record.CreatedAt, &record.ExpiresAt)
+	record.Response = response
+	return record, false, err
+}
+
+// completeIdempotencyKey stores the response of the request that reserved
+// key, inside the transaction that carried the request out.
+func completeIdempotencyKey(tx *sql.Tx, key string, statusCode int, response []byte) error {
+	_, err := tx.Exec(
+		"UPDATE idempotency_keys SET status_code = $1, response = $2 WHERE key = $3",
+		statusCode, string(response), key,
+	)
+	return err
+}
+
+// Release frees a reserved key whose request failed, so it can be retried.
+func (r *idempotencyRepository) Release(key string) error {
+	_, err := r.db.Exec("DELETE FROM idempotency_keys WHERE key = $1 AND status_code IS NULL", key)
+	return err
+}
+
+func (r *idempotencyRepository) DeleteExpired() (int64, error) {
+	res, err := r.db.Exec("DELETE FROM idempotency_keys WHERE expires_at < NOW()")
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -3,14 +3,26 @@ package repositories
 import (
 	"category-api/models"
 	"database/sql"
+	"encoding/json"
+	"strings"
+
+	"github.com/lib/pq"
 )
 
 type ProductRepository interface {
-	GetAll(name string) ([]models.Produk, error)
+	GetAll(filter models.ProductFilter) ([]models.Produk, int, error)
+	Each(filter models.ProductFilter, fn func(models.Produk) error) error
 	GetByID(id int) (models.Produk, error)
-	Create(p models.Produk) (models.Produk, error)
+	GetByIDIncludingDeleted(id int) (models.Produk, error)
+	GetByBarcode(code string) (models.Produk, error)
+	Create(p models.Produk, actor string) (models.Produk, error)
 	Update(id int, p models.Produk) (models.Produk, error)
 	Delete(id int) error
+	Restore(id int) (models.Produk, error)
+	GetIDsBySKU(skus []string) (map[string]int, error)
+	GetIDsByBarcode(codes []string) (map[string]int, error)
+	GetLowStock(categoryID string) ([]models.LowStockItem, error)
+	Import(rows []models.ImportRow, actor string) (created, updated int, err error)
 }
 
 type productRepository struct {
@@ -21,57 +33,370 @@ func NewProductRepository(db *sql.DB) ProductRepository {
 	return &productRepository{db}
 }
 
-func (r *productRepository) GetAll(name string) ([]models.Produk, error) {
-	var rows *sql.Rows
-	var err error
+// productColumns selects a product row with its barcodes aggregated into an
+// array; scan it with scanProduct.
+const productColumns = `id, nama, harga, harga_pokok, stok, reorder_point, COALESCE(category_id, ''), COALESCE(tax_rate_id, 0), COALESCE(sku, ''),
+	ARRAY(SELECT code FROM product_barcodes b WHERE b.product_id = products.id ORDER BY code), option_axes, deleted_at`
+
+// rowScanner is implemented by *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanProduct(row rowScanner) (models.Produk, error) {
+	var p models.Produk
+	err := row.Scan(&p.ID, &p.Nama, &p.Harga, &p.HargaPokok, &p.Stok, &p.ReorderPoint, &p.CategoryID, &p.TaxRateID, &p.SKU, pq.Array(&p.Barcodes), pq.Array(&p.OptionAxes), &p.DeletedAt)
+	if err != nil {
+		return p, err
+	}
+	p.SetMargin()
+	return p, nil
+}
+
+// productSortColumns maps the sort fields accepted by GetAll to columns.
+var productSortColumns = map[string]string{
+	"id":            "id",
+	"nama":          "nama",
+	"harga":         "harga",
+	"harga_pokok":   "harga_pokok",
+	"margin":        "harga - harga_pokok",
+	"stok":          "stok",
+	"reorder_point": "reorder_point",
+}
 
-	if name != "" {
+// productQuery builds the WHERE and ORDER BY clauses selecting the products matching filter.
+func productQuery(filter models.ProductFilter) (queryBuilder, string, error) {
+	var q queryBuilder
+	if !filter.IncludeDeleted {
+		q.conds = append(q.conds, "deleted_at IS NULL")
+	}
+	if filter.Name != "" {
 		// Search by name using ILIKE for case-insensitive matching
-		rows, err = r.db.Query("SELECT id, nama, harga, stok FROM products WHERE nama ILIKE '%' || $1 || '%'", name)
-	} else {
-		rows, err = r.db.Query("SELECT id, nama, harga, stok FROM products")
+		q.where("nama ILIKE '%' || $%d || '%'", filter.Name)
+	}
+	if filter.CategoryID != "" && filter.IncludeDescendants {
+		q.conds = append(q.conds, "category_id IN "+categoryDescendants(q.arg(filter.CategoryID)))
+	} else if filter.CategoryID != "" {
+		q.where("category_id = $%d", filter.CategoryID)
 	}
+	if filter.SKU != "" {
+		q.where("sku = $%d", filter.SKU)
+	}
+	if filter.MinHarga != nil {
+		q.where("harga >= $%d", *filter.MinHarga)
+	}
+	if filter.MaxHarga != nil {
+		q.where("harga <= $%d", *filter.MaxHarga)
+	}
+	if filter.MinStok != nil {
+		q.where("stok >= $%d", *filter.MinStok)
+	}
+	if filter.MaxStok != nil {
+		q.where("stok <= $%d", *filter.MaxStok)
+	}
+
+	order, err := orderBy(filter.Sort, productSortColumns, "", "id")
+	return q, order, err
+}
 
+// GetAll returns one page of the products matching filter together with the
+// total number of matching products.
+func (r *productRepository) GetAll(filter models.ProductFilter) ([]models.Produk, int, error) {
+	q, order, err := productQuery(filter)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
+	}
+
+	var total int
+	if err := r.db.QueryRow("SELECT COUNT(*) FROM products"+q.whereClause(), q.args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := "SELECT " + productColumns + " FROM products" + q.whereClause() + order +
+		" LIMIT " + q.arg(filter.Limit) + " OFFSET " + q.arg(filter.Offset())
+	rows, err := r.db.Query(query, q.args...)
+	if err != nil {
+		return nil, 0, err
 	}
 	defer rows.Close()
 
 	var products []models.Produk
 	for rows.Next() {
-		var p models.Produk
-		if err := rows.Scan(&p.ID, &p.Nama, &p.Harga, &p.Stok); err != nil {
-			return nil, err
+		p, err := scanProduct(rows)
+		if err != nil {
+			return nil, 0, err
 		}
 		products = append(products, p)
 	}
-	return products, nil
+	return products, total, rows.Err()
+}
+
+// Each calls fn for every product matching filter, ignoring its pagination,
+// as rows arrive from the database. It stops at the first error fn returns.
+func (r *productRepository) Each(filter models.ProductFilter, fn func(models.Produk) error) error {
+	q, order, err := productQuery(filter)
+	if err != nil {
+		return err
+	}
+	rows, err := r.db.Query("SELECT "+productColumns+" FROM products"+q.whereClause()+order, q.args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		p, err := scanProduct(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(p); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
 }
 
 func (r *productRepository) GetByID(id int) (models.Produk, error) {
-	var p models.Produk
-	err := r.db.QueryRow("SELECT id, nama, harga, stok FROM products WHERE id = $1", id).
-		Scan(&p.ID, &p.Nama, &p.Harga, &p.Stok)
-	return p, err
+	p, err := scanProduct(r.db.QueryRow("SELECT "+productColumns+" FROM products WHERE id = $1 AND deleted_at IS NULL", id))
+	return p, mapError(err, ErrProductNotFound)
 }
 
-func (r *productRepository) Create(p models.Produk) (models.Produk, error) {
-	err := r.db.QueryRow("INSERT INTO products (nama, harga, stok) VALUES ($1, $2, $3) RETURNING id",
-		p.Nama, p.Harga, p.Stok).Scan(&p.ID)
-	return p, err
+// GetByIDIncludingDeleted returns a product whether or not it has been soft
+// deleted.
+func (r *productRepository) GetByIDIncludingDeleted(id int) (models.Produk, error) {
+	p, err := scanProduct(r.db.QueryRow("SELECT "+productColumns+" FROM products WHERE id = $1", id))
+	return p, mapError(err, ErrProductNotFound)
 }
 
+// GetByBarcode returns the product a scanned barcode belongs to.
+func (r *productRepository) GetByBarcode(code string) (models.Produk, error) {
+	p, err := scanProduct(r.db.QueryRow(
+		"SELECT "+productColumns+" FROM products WHERE id = (SELECT product_id FROM product_barcodes WHERE code = $1) AND deleted_at IS NULL", code))
+	return p, mapError(err, ErrProductNotFound)
+}
+
+// Create inserts a product; its opening stock is recorded in the ledger as
+// an initial movement by actor.
+func (r *productRepository) Create(p models.Produk, actor string) (models.Produk, error) {
+	var created models.Produk
+	err := runInTx(r.db, func(tx *sql.Tx) error {
+		var id int
+		err := tx.QueryRow("INSERT INTO products (nama, harga, harga_pokok, reorder_point, category_id, tax_rate_id, sku, option_axes) VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, 0), NULLIF($7, ''), $8) RETURNING id",
+			p.Nama, p.Harga, p.HargaPokok, p.ReorderPoint, p.CategoryID, p.TaxRateID, p.SKU, pq.Array(optionAxes(p))).Scan(&id)
+		if err != nil {
+			return err
+		}
+		if err := replaceBarcodes(tx, id, p.Barcodes); err != nil {
+			return err
+		}
+		_, err = moveStock(tx, models.StockMovement{ProductID: id, Type: models.StockInitial, Quantity: p.Stok, Actor: actor})
+		if err != nil {
+			return err
+		}
+		created, err = scanProduct(tx.QueryRow("SELECT "+productColumns+" FROM products WHERE id = $1", id))
+		return err
+	})
+	if err != nil {
+		return p, mapError(err, nil)
+	}
+	return created, nil
+}
+
+// Update replaces every editable field of a product, including its barcodes.
+// Stock is not editable; it only changes through stock movements.
 func (r *productRepository) Update(id int, p models.Produk) (models.Produk, error) {
-	_, err := r.db.Exec("UPDATE products SET nama = $1, harga = $2, stok = $3 WHERE id = $4",
-		p.Nama, p.Harga, p.Stok, id)
+	var updated models.Produk
+	err := runInTx(r.db, func(tx *sql.Tx) error {
+		res, err := tx.Exec("UPDATE products SET nama = $1, harga = $2, harga_pokok = $3, reorder_point = $4, category_id = NULLIF($5, ''), tax_rate_id = NULLIF($6, 0), sku = NULLIF($7, ''), option_axes = $8 WHERE id = $9 AND deleted_at IS NULL",
+			p.Nama, p.Harga, p.HargaPokok, p.ReorderPoint, p.CategoryID, p.TaxRateID, p.SKU, pq.Array(optionAxes(p)), id)
+		if err != nil {
+			return err
+		}
+		if err := checkAffected(res, ErrProductNotFound); err != nil {
+			return err
+		}
+		if err := replaceBarcodes(tx, id, p.Barcodes); err != nil {
+			return err
+		}
+		updated, err = scanProduct(tx.QueryRow("SELECT "+productColumns+" FROM products WHERE id = $1", id))
+		return err
+	})
 	if err != nil {
-		return p, err
+		return p, mapError(err, ErrProductNotFound)
 	}
-	p.ID = id
-	return p, nil
+	return updated, nil
 }
 
-func (r *productRepository) Delete(id int) error {
-	_, err := r.db.Exec("DELETE FROM products WHERE id = $1", id)
+// optionAxes returns the option axes of p as a non-nil slice, since the
+// column is NOT NULL and pq encodes a nil slice as NULL.
+func optionAxes(p models.Produk) []string {
+	if p.OptionAxes == nil {
+		return []string{}
+	}
+	return p.OptionAxes
+}
+
+// replaceBarcodes makes codes the complete set of barcodes of a product.
+func replaceBarcodes(tx *sql.Tx, productID int, codes []string) error {
+	if _, err := tx.Exec("DELETE FROM product_barcodes WHERE product_id = $1", productID); err != nil {
+		return err
+	}
+	if len(codes) == 0 {
+		return nil
+	}
+	_, err := tx.Exec(
+		"INSERT INTO product_barcodes (code, product_id) SELECT unnest($1::text[]), $2",
+		pq.Array(codes), productID,
+	)
 	return err
-}
\ No newline at end of file
+}
+
+// Delete soft deletes a product: it disappears from listings and checkout
+// but keeps its sales history and can be restored.
+func (r *productRepository) Delete(id int) error {
+	res, err := r.db.Exec("UPDATE products SET deleted_at = NOW() WHERE id = $1 AND deleted_at IS NULL", id)
+	if err != nil {
+		return mapError(err, nil)
+	}
+	return checkAffected(res, ErrProductNotFound)
+}
+
+// Restore undoes a soft delete. Restoring a product that is not deleted
+// simply returns it.
+func (r *productRepository) Restore(id int) (models.Produk, error) {
+	p, err := scanProduct(r.db.QueryRow("UPDATE products SET deleted_at = NULL WHERE id = $1 RETURNING "+productColumns, id))
+	return p, mapError(err, ErrProductNotFound)
+}
+
+// GetIDsBySKU returns the IDs of the products owning any of skus, keyed by SKU.
+func (r *productRepository) GetIDsBySKU(skus []string) (map[string]int, error) {
+	rows, err := r.db.Query("SELECT sku, id FROM products WHERE sku = ANY($1)", pq.Array(skus))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make(map[string]int)
+	for rows.Next() {
+		var sku string
+		var id int
+		if err := rows.Scan(&sku, &id); err != nil {
+			return nil, err
+		}
+		ids[sku] = id
+	}
+	return ids, rows.Err()
+}
+
+// GetIDsByBarcode returns the IDs of the products, deleted ones included,
+// owning any of codes, keyed by barcode.
+func (r *productRepository) GetIDsByBarcode(codes []string) (map[string]int, error) {
+	rows, err := r.db.Query("SELECT code, product_id FROM product_barcodes WHERE code = ANY($1)", pq.Array(codes))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make(map[string]int)
+	for rows.Next() {
+		var code string
+		var id int
+		if err := rows.Scan(&code, &id); err != nil {
+			return nil, err
+		}
+		ids[code] = id
+	}
+	return ids, rows.Err()
+}
+
+// GetLowStock lists the products that are not deleted, and the variants of
+// products with variants, whose stock is at or below the product's reorder
+// point, most urgent first. An empty categoryID lists every category.
+func (r *productRepository) GetLowStock(categoryID string) ([]models.LowStockItem, error) {
+	rows, err := r.db.Query(`
+		SELECT p.id, COALESCE(v.id, 0), p.nama, p.option_axes, COALESCE(v.options, '{}'),
+			COALESCE(v.sku, p.sku, ''), COALESCE(p.category_id, ''), COALESCE(v.stok, p.stok), p.reorder_point
+		FROM products p
+		LEFT JOIN product_variants v ON v.product_id = p.id
+		WHERE p.deleted_at IS NULL AND p.reorder_point > 0
+			AND COALESCE(v.stok, p.stok) <= p.reorder_point
+			AND ($1 = '' OR p.category_id = $1)
+		ORDER BY COALESCE(v.stok, p.stok) - p.reorder_point, p.id, v.id`,
+		categoryID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []models.LowStockItem{}
+	for rows.Next() {
+		var item models.LowStockItem
+		var axes []string
+		var options []byte
+		if err := rows.Scan(&item.ProductID, &item.VariantID, &item.Nama, pq.Array(&axes), &options,
+			&item.SKU, &item.CategoryID, &item.Stok, &item.ReorderPoint); err != nil {
+			return nil, err
+		}
+		if item.VariantID != 0 {
+			var v models.ProductVariant
+			if err := json.Unmarshal(options, &v.Options); err != nil {
+				return nil, err
+			}
+			item.VariantName = v.Name(axes)
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// importUpdateColumns are the product columns an import row may update, besides
+// nama, which every row gives.
+var importUpdateColumns = []string{"harga", "harga_pokok", "reorder_point", "category_id"}
+
+// Import writes every row in one transaction: rows whose SKU already exists
+// update (and restore, if soft deleted) that product, all others are created.
+// An update only sets the columns the row gives, and barcodes are only
+// replaced when a row lists them. The stock of a row that gives one is taken
+// as counted: the difference to the current stock is recorded as an import
+// movement by actor. A failing row rolls back the whole import and is
+// reported as a *RowError.
+func (r *productRepository) Import(rows []models.ImportRow, actor string) (created, updated int, err error) {
+	err = runInTx(r.db, func(tx *sql.Tx) error {
+		created, updated = 0, 0
+		for _, row := range rows {
+			p := row.Produk
+			sets := []string{"nama = EXCLUDED.nama"}
+			for _, column := range importUpdateColumns {
+				if row.Has(column) {
+					sets = append(sets, column+" = EXCLUDED."+column)
+				}
+			}
+			var id int
+			var inserted bool
+			err := tx.QueryRow(`
+				INSERT INTO products (nama, harga, harga_pokok, reorder_point, category_id, sku)
+				VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, ''))
+				ON CONFLICT (sku) DO UPDATE SET `+strings.Join(sets, ", ")+`, deleted_at = NULL
+				RETURNING id, xmax = 0`,
+				p.Nama, p.Harga, p.HargaPokok, p.ReorderPoint, p.CategoryID, p.SKU,
+			).Scan(&id, &inserted)
+			if err == nil && p.Barcodes != nil {
+				err = replaceBarcodes(tx, id, p.Barcodes)
+			}
+			if err == nil && row.Has("stok") {
+				err = countStock(tx, models.StockMovement{ProductID: id, Type: models.StockImport, Actor: actor}, p.Stok)
+			}
+			if err != nil {
+				return &RowError{Line: row.Line, Err: mapError(err, nil)}
+			}
+			if inserted {
+				created++
+			} else {
+				updated++
+			}
+		}
+		return nil
+	})
+	return created, updated, err
+}
@@ -0,0 +1,126 @@
+package repositories
+
+import (
+	"category-api/models"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+type PromoRepository interface {
+	GetAll() ([]models.PromoCode, error)
+	GetByID(id int) (models.PromoCode, error)
+	Create(p models.PromoCode) (models.PromoCode, error)
+	Update(id int, p models.PromoCode) (models.PromoCode, error)
+	Delete(id int) error
+}
+
+type promoRepository struct {
+	db *sql.DB
+}
+
+func NewPromoRepository(db *sql.DB) PromoRepository {
+	return &promoRepository{db}
+}
+
+const promoColumns = "id, code, description, discount_type, discount_value, min_spend, starts_at, ends_at, usage_limit, used_count, active, created_at"
+
+func scanPromo(row rowScanner) (models.PromoCode, error) {
+	var p models.PromoCode
+	err := row.Scan(&p.ID, &p.Code, &p.Description, &p.Discount.Type, &p.Discount.Value, &p.MinSpend,
+		&p.StartsAt, &p.EndsAt, &p.UsageLimit, &p.UsedCount, &p.Active, &p.CreatedAt)
+	return p, err
+}
+
+// GetAll returns every promo code, newest first.
+func (r *promoRepository) GetAll() ([]models.PromoCode, error) {
+	rows, err := r.db.Query("SELECT " + promoColumns + " FROM promo_codes ORDER BY id DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	promos := []models.PromoCode{}
+	for rows.Next() {
+		p, err := scanPromo(rows)
+		if err != nil {
+			return nil, err
+		}
+		promos = append(promos, p)
+	}
+	return promos, rows.Err()
+}
+
+func (r *promoRepository) GetByID(id int) (models.PromoCode, error) {
+	p, err := scanPromo(r.db.QueryRow("SELECT "+promoColumns+" FROM promo_codes WHERE id = $1", id))
+	return p, mapError(err, ErrPromoCodeNotFound)
+}
+
+func (r *promoRepository) Create(p models.PromoCode) (models.PromoCode, error) {
+	created, err := scanPromo(r.db.QueryRow(`
+		INSERT INTO promo_codes (code, description, discount_type, discount_value, min_spend, starts_at, ends_at, usage_limit, active)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING `+promoColumns,
+		p.Code, p.Description, p.Discount.Type, p.Discount.Value, p.MinSpend, p.StartsAt, p.EndsAt, p.UsageLimit, p.Active,
+	))
+	if err != nil {
+		return p, mapError(err, nil)
+	}
+	return created, nil
+}
+
+// Update replaces a promo code's settings. Its usage count is kept.
+func (r *promoRepository) Update(id int, p models.PromoCode) (models.PromoCode, error) {
+	updated, err := scanPromo(r.db.QueryRow(`
+		UPDATE promo_codes SET code = $1, description = $2, discount_type = $3, discount_value = $4, min_spend = $5,
+			starts_at = $6, ends_at = $7, usage_limit = $8, active = $9
+		WHERE id = $10
+		RETURNING `+promoColumns,
+		p.Code, p.Description, p.Discount.Type, p.Discount.Value, p.MinSpend, p.StartsAt, p.EndsAt, p.UsageLimit, p.Active, id,
+	))
+	if err != nil {
+		return p, mapError(err, ErrPromoCodeNotFound)
+	}
+	return updated, nil
+}
+
+// Delete removes a promo code. Transactions that redeemed it keep the code
+// they were sold with.
+func (r *promoRepository) Delete(id int) error {
+	res, err := r.db.Exec("DELETE FROM promo_codes WHERE id = $1", id)
+	if err != nil {
+		return mapError(err, nil)
+	}
+	return checkAffected(res, ErrPromoCodeNotFound)
+}
+
+// redeemPromo locks the promo code matching code, ignoring case, checks it
+// can be used on a cart worth spend after line discounts, and counts the use.
+func redeemPromo(tx *sql.Tx, code string, spend int) (models.PromoCode, error) {
+	var now time.Time
+	var p models.PromoCode
+	err := tx.QueryRow("SELECT "+promoColumns+", NOW() FROM promo_codes WHERE UPPER(code) = UPPER($1) FOR UPDATE", code).Scan(
+		&p.ID, &p.Code, &p.Description, &p.Discount.Type, &p.Discount.Value, &p.MinSpend,
+		&p.StartsAt, &p.EndsAt, &p.UsageLimit, &p.UsedCount, &p.Active, &p.CreatedAt, &now,
+	)
+	if err != nil {
+		return p, mapError(err, ErrPromoCodeNotFound.WithMessage(fmt.Sprintf("promo code %q not found", code)))
+	}
+
+	switch {
+	case !p.Active:
+		return p, ErrPromoCodeUnavailable.WithMessage(fmt.Sprintf("promo code %q is not active", p.Code))
+	case p.StartsAt != nil && now.Before(*p.StartsAt):
+		return p, ErrPromoCodeUnavailable.WithMessage(fmt.Sprintf("promo code %q is not valid until %s", p.Code, p.StartsAt.Format(time.RFC3339)))
+	case p.EndsAt != nil && !now.Before(*p.EndsAt):
+		return p, ErrPromoCodeUnavailable.WithMessage(fmt.Sprintf("promo code %q expired at %s", p.Code, p.EndsAt.Format(time.RFC3339)))
+	case p.UsageLimit > 0 && p.UsedCount >= p.UsageLimit:
+		return p, ErrPromoCodeUnavailable.WithMessage(fmt.Sprintf("promo code %q has reached its usage limit", p.Code))
+	case spend < p.MinSpend:
+		return p, ErrPromoMinSpend.WithDetails(map[string]int{"min_spend": p.MinSpend, "subtotal": spend})
+	}
+
+	_, err = tx.Exec("UPDATE promo_codes SET used_count = used_count + 1 WHERE id = $1", p.ID)
+	p.UsedCount++
+	return p, err
+}
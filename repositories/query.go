@@ -0,0 +1,65 @@
+package repositories
+
+import (
+	"category-api/apperrors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidSort is returned when a sort parameter names an unknown field.
+var ErrInvalidSort = apperrors.BadRequest("invalid_sort", "invalid sort field")
+
+// queryBuilder collects WHERE conditions and their positional arguments.
+type queryBuilder struct {
+	conds []string
+	args  []interface{}
+}
+
+// where adds a condition; every %d in cond is replaced by the placeholder of value.
+func (b *queryBuilder) where(cond string, value interface{}) {
+	b.args = append(b.args, value)
+	n := len(b.args)
+	b.conds = append(b.conds, strings.ReplaceAll(cond, "%d", fmt.Sprint(n)))
+}
+
+// arg appends value and returns its placeholder.
+func (b *queryBuilder) arg(value interface{}) string {
+	b.args = append(b.args, value)
+	return fmt.Sprintf("$%d", len(b.args))
+}
+
+// whereClause returns the combined conditions, or "" when there are none.
+func (b *queryBuilder) whereClause() string {
+	if len(b.conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(b.conds, " AND ")
+}
+
+// orderBy turns a sort parameter such as "harga,-nama" into an ORDER BY
+// clause using the allowed field to column mapping. tieBreaker is appended
+// so paging is stable.
+func orderBy(sort string, columns map[string]string, fallback string, tieBreaker string) (string, error) {
+	var terms []string
+	for _, field := range strings.Split(sort, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		direction := "ASC"
+		if strings.HasPrefix(field, "-") {
+			direction = "DESC"
+			field = field[1:]
+		}
+		column, ok := columns[field]
+		if !ok {
+			return "", ErrInvalidSort.WithMessage(fmt.Sprintf("cannot sort by %q", field))
+		}
+		terms = append(terms, column+" "+direction)
+	}
+	if len(terms) == 0 && fallback != "" {
+		terms = append(terms, fallback)
+	}
+	terms = append(terms, tieBreaker)
+	return " ORDER BY " + strings.Join(terms, ", "), nil
+}
@@ -0,0 +1,291 @@
+package repositories
+
+import (
+	"category-api/models"
+	"database/sql"
+	"fmt"
+	"sort"
+)
+
+type ReversalRepository interface {
+	Void(transactionID int, req models.VoidRequest) (models.Reversal, error)
+	Refund(transactionID int, req models.RefundRequest) (models.Reversal, error)
+	GetByTransactionID(transactionID int) ([]models.Reversal, error)
+}
+
+type reversalRepository struct {
+	db *sql.DB
+}
+
+func NewReversalRepository(db *sql.DB) ReversalRepository {
+	return &reversalRepository{db}
+}
+
+// reversibleLine is a transaction line with the quantity, amount and tax
+// already returned by earlier refunds.
+type reversibleLine struct {
+	detail           models.TransactionDetail
+	refundedQuantity int
+	refundedAmount   int
+	refundedTax      int
+}
+
+func (l reversibleLine) remaining() int {
+	return l.detail.Quantity - l.refundedQuantity
+}
+
+// amountFor returns the share of the line total, tax included, refunded for
+// quantity units.
+func (l reversibleLine) amountFor(quantity int) int {
+	return models.RefundShare(l.detail.Total, l.detail.Quantity, l.refundedQuantity, l.refundedAmount, quantity)
+}
+
+// taxFor returns the share of the line tax contained in the amount refunded
+// for quantity units.
+func (l reversibleLine) taxFor(quantity int) int {
+	return models.RefundShare(l.detail.TaxAmount, l.detail.Quantity, l.refundedQuantity, l.refundedTax, quantity)
+}
+
+// Void cancels a whole transaction, puts every sold unit back in stock and
+// gives back the use of any promo code it redeemed. Transactions that
+// already have refunds cannot be voided; the remaining lines must be
+// refunded instead.
+func (r *reversalRepository) Void(transactionID int, req models.VoidRequest) (models.Reversal, error) {
+	var reversal models.Reversal
+	err := runInTx(r.db, func(tx *sql.Tx) error {
+		status, err := lockTransaction(tx, transactionID)
+		if err != nil {
+			return err
+		}
+		switch status {
+		case models.TransactionVoided:
+			return ErrTransactionVoided
+		case models.TransactionPartiallyRefunded, models.TransactionRefunded:
+			return ErrTransactionRefunded
+		}
+
+		lines, err := reversibleLines(tx, transactionID)
+		if err != nil {
+			return err
+		}
+		quantities := make(map[int]int, len(lines))
+		for id, line := range lines {
+			quantities[id] = line.remaining()
+		}
+
+		reversal, err = insertReversal(tx, transactionID, models.ReversalVoid, req.ReasonCode, req.Note, req.Actor, lines, quantities)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(
+			"UPDATE promo_codes SET used_count = used_count - 1 WHERE id = (SELECT promo_code_id FROM transactions WHERE id = $1) AND used_count > 0",
+			transactionID,
+		)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("UPDATE transactions SET status = $1 WHERE id = $2", models.TransactionVoided, transactionID)
+		return err
+	})
+	return reversal, err
+}
+
+// Refund returns individual transaction lines and restocks the returned units.
+func (r *reversalRepository) Refund(transactionID int, req models.RefundRequest) (models.Reversal, error) {
+	var reversal models.Reversal
+	err := runInTx(r.db, func(tx *sql.Tx) error {
+		status, err := lockTransaction(tx, transactionID)
+		if err != nil {
+			return err
+		}
+		if status == models.TransactionVoided {
+			return ErrTransactionVoided
+		}
+
+		lines, err := reversibleLines(tx, transactionID)
+		if err != nil {
+			return err
+		}
+
+		quantities := make(map[int]int)
+		for _, item := range req.Items {
+			quantities[item.TransactionDetailID] += item.Quantity
+		}
+		for detailID, quantity := range quantities {
+			line, ok := lines[detailID]
+			if !ok {
+				return ErrInvalidRefund.WithMessage(fmt.Sprintf("line %d does not belong to transaction %d", detailID, transactionID))
+			}
+			if quantity > line.remaining() {
+				return ErrInvalidRefund.WithMessage(fmt.Sprintf("only %d of %q can still be refunded", line.remaining(), line.detail.ProductName))
+			}
+		}
+
+		reversal, err = insertReversal(tx, transactionID, models.ReversalRefund, req.ReasonCode, req.Note, req.Actor, lines, quantities)
+		if err != nil {
+			return err
+		}
+
+		newStatus := models.TransactionRefunded
+		for id, line := range lines {
+			if line.remaining() > quantities[id] {
+				newStatus = models.TransactionPartiallyRefunded
+				break
+			}
+		}
+		_, err = tx.Exec("UPDATE transactions SET status = $1 WHERE id = $2", newStatus, transactionID)
+		return err
+	})
+	return reversal, err
+}
+
+func (r *reversalRepository) GetByTransactionID(transactionID int) ([]models.Reversal, error) {
+	rows, err := r.db.Query(`
+		SELECT rv.id, rv.transaction_id, rv.type, rv.reason_code, rv.note, rv.amount, rv.created_at,
+			ri.id, ri.transaction_detail_id, COALESCE(td.product_id, 0), td.product_name,
+			COALESCE(td.variant_id, 0), td.variant_name, ri.quantity, ri.amount, ri.tax_amount
+		FROM transaction_reversals rv
+		JOIN transaction_reversal_items ri ON ri.reversal_id = rv.id
+		JOIN transaction_details td ON td.id = ri.transaction_detail_id
+		WHERE rv.transaction_id = $1
+		ORDER BY rv.id, ri.id
+	`, transactionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reversals []models.Reversal
+	for rows.Next() {
+		var rv models.Reversal
+		var item models.ReversalItem
+		if err := rows.Scan(&rv.ID, &rv.TransactionID, &rv.Type, &rv.ReasonCode, &rv.Note, &rv.Amount, &rv.CreatedAt,
+			&item.ID, &item.TransactionDetailID, &item.ProductID, &item.ProductName,
+			&item.VariantID, &item.VariantName, &item.Quantity, &item.Amount, &item.TaxAmount); err != nil {
+			return nil, err
+		}
+		item.ReversalID = rv.ID
+		if n := len(reversals); n == 0 || reversals[n-1].ID != rv.ID {
+			reversals = append(reversals, rv)
+		}
+		last := &reversals[len(reversals)-1]
+		last.Items = append(last.Items, item)
+		last.TaxAmount += item.TaxAmount
+	}
+	return reversals, rows.Err()
+}
+
+// lockTransaction locks a transaction row for the rest of tx and returns its status.
+func lockTransaction(tx *sql.Tx, transactionID int) (string, error) {
+	var status string
+	err := tx.QueryRow("SELECT status FROM transactions WHERE id = $1 FOR UPDATE", transactionID).Scan(&status)
+	return status, mapError(err, ErrTransactionNotFound)
+}
+
+// reversibleLines loads the lines of a transaction keyed by detail ID.
+func reversibleLines(tx *sql.Tx, transactionID int) (map[int]reversibleLine, error) {
+	rows, err := tx.Query(`
+		SELECT td.id, COALESCE(td.product_id, 0), td.product_name, COALESCE(td.variant_id, 0), td.variant_name,
+			td.quantity, td.total, td.tax_amount,
+			COALESCE(SUM(ri.quantity), 0), COALESCE(SUM(ri.amount), 0), COALESCE(SUM(ri.tax_amount), 0)
+		FROM transaction_details td
+		LEFT JOIN transaction_reversal_items ri ON ri.transaction_detail_id = td.id
+		WHERE td.transaction_id = $1
+		GROUP BY td.id
+	`, transactionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lines := make(map[int]reversibleLine)
+	for rows.Next() {
+		var line reversibleLine
+		d := &line.detail
+		if err := rows.Scan(&d.ID, &d.ProductID, &d.ProductName, &d.VariantID, &d.VariantName, &d.Quantity, &d.Total, &d.TaxAmount,
+			&line.refundedQuantity, &line.refundedAmount, &line.refundedTax); err != nil {
+			return nil, err
+		}
+		d.TransactionID = transactionID
+		lines[d.ID] = line
+	}
+	return lines, rows.Err()
+}
+
+// insertReversal records a reversal of the given quantities per detail ID and
+// puts the returned units back in stock, recording them in the ledger on
+// behalf of actor. Lines with a zero quantity are skipped.
+func insertReversal(tx *sql.Tx, transactionID int, reversalType, reasonCode, note, actor string, lines map[int]reversibleLine, quantities map[int]int) (models.Reversal, error) {
+	reversal := models.Reversal{
+		TransactionID: transactionID,
+		Type:          reversalType,
+		ReasonCode:    reasonCode,
+		Note:          note,
+	}
+
+	detailIDs := make([]int, 0, len(quantities))
+	for id, quantity := range quantities {
+		if quantity > 0 {
+			detailIDs = append(detailIDs, id)
+		}
+	}
+	if len(detailIDs) == 0 {
+		return reversal, ErrInvalidRefund.WithMessage("nothing left to reverse")
+	}
+	sort.Ints(detailIDs)
+
+	// Units go back to the variant they were sold as; lines whose variant
+	// has since been deleted are not restocked
+	restock := make(map[stockKey]int)
+	for _, id := range detailIDs {
+		line := lines[id]
+		item := models.ReversalItem{
+			TransactionDetailID: id,
+			ProductID:           line.detail.ProductID,
+			ProductName:         line.detail.ProductName,
+			VariantID:           line.detail.VariantID,
+			VariantName:         line.detail.VariantName,
+			Quantity:            quantities[id],
+			Amount:              line.amountFor(quantities[id]),
+			TaxAmount:           line.taxFor(quantities[id]),
+		}
+		reversal.Items = append(reversal.Items, item)
+		reversal.Amount += item.Amount
+		reversal.TaxAmount += item.TaxAmount
+		if item.ProductID != 0 && (item.VariantID != 0 || line.detail.VariantName == "") {
+			restock[stockKey{item.ProductID, item.VariantID}] += item.Quantity
+		}
+	}
+
+	err := tx.QueryRow(
+		"INSERT INTO transaction_reversals (transaction_id, type, reason_code, note, amount) VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at",
+		transactionID, reversalType, reasonCode, note, reversal.Amount,
+	).Scan(&reversal.ID, &reversal.CreatedAt)
+	if err != nil {
+		return reversal, err
+	}
+
+	for i := range reversal.Items {
+		item := &reversal.Items[i]
+		item.ReversalID = reversal.ID
+		err := tx.QueryRow(
+			"INSERT INTO transaction_reversal_items (reversal_id, transaction_detail_id, quantity, amount, tax_amount) VALUES ($1, $2, $3, $4, $5) RETURNING id",
+			reversal.ID, item.TransactionDetailID, item.Quantity, item.Amount, item.TaxAmount,
+		).Scan(&item.ID)
+		if err != nil {
+			return reversal, err
+		}
+	}
+
+	movementType := models.StockRefund
+	if reversalType == models.ReversalVoid {
+		movementType = models.StockVoid
+	}
+	_, err = moveStocks(tx, restock, models.StockMovement{
+		Type:      movementType,
+		Reason:    reasonCode,
+		Reference: transactionReference(transactionID),
+		Actor:     actor,
+	})
+	return reversal, err
+}
@@ -0,0 +1,206 @@
+package repositories
+
+import (
+	"category-api/models"
+	"database/sql"
+	"fmt"
+	"sort"
+)
+
+type StockRepository interface {
+	Adjust(m models.StockMovement) (models.StockMovement, error)
+	GetMovements(filter models.StockMovementFilter) ([]models.StockMovement, int, error)
+}
+
+type stockRepository struct {
+	db *sql.DB
+}
+
+func NewStockRepository(db *sql.DB) StockRepository {
+	return &stockRepository{db}
+}
+
+const stockMovementColumns = "id, product_id, COALESCE(variant_id, 0), type, quantity, stok_after, reason, reference, actor, created_at"
+
+func scanStockMovement(row rowScanner) (models.StockMovement, error) {
+	var m models.StockMovement
+	err := row.Scan(&m.ID, &m.ProductID, &m.VariantID, &m.Type, &m.Quantity, &m.StokAfter, &m.Reason, &m.Reference, &m.Actor, &m.CreatedAt)
+	return m, err
+}
+
+// Adjust applies a manual stock movement to a product that is not deleted.
+// Products with variants are adjusted per variant.
+func (r *stockRepository) Adjust(m models.StockMovement) (models.StockMovement, error) {
+	var recorded models.StockMovement
+	err := runInTx(r.db, func(tx *sql.Tx) error {
+		var hasVariants bool
+		err := tx.QueryRow(`
+			SELECT EXISTS (SELECT 1 FROM product_variants v WHERE v.product_id = products.id)
+			FROM products WHERE id = $1 AND deleted_at IS NULL`,
+			m.ProductID,
+		).Scan(&hasVariants)
+		if err != nil {
+			return mapError(err, ErrProductNotFound)
+		}
+		if m.VariantID == 0 && hasVariants {
+			return ErrVariantRequired.WithMessage("product is stocked by variant; variant_id is required")
+		}
+		recorded, err = moveStock(tx, m)
+		return err
+	})
+	return recorded, err
+}
+
+// GetMovements returns one page of a product's ledger, newest first, and the
+// number of entries matching the filter.
+func (r *stockRepository) GetMovements(filter models.StockMovementFilter) ([]models.StockMovement, int, error) {
+	var q queryBuilder
+	q.where("product_id = $%d", filter.ProductID)
+	if filter.VariantID != 0 {
+		q.where("variant_id = $%d", filter.VariantID)
+	}
+	if filter.Type != "" {
+		q.where("type = $%d", filter.Type)
+	}
+
+	var total int
+	if err := r.db.QueryRow("SELECT COUNT(*) FROM stock_movements"+q.whereClause(), q.args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	where := q.whereClause()
+	limit := q.arg(filter.Limit)
+	offset := q.arg(filter.Offset())
+	rows, err := r.db.Query(
+		"SELECT "+stockMovementColumns+" FROM stock_movements"+where+" ORDER BY id DESC LIMIT "+limit+" OFFSET "+offset,
+		q.args...,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	movements := []models.StockMovement{}
+	for rows.Next() {
+		m, err := scanStockMovement(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		movements = append(movements, m)
+	}
+	return movements, total, rows.Err()
+}
+
+// moveStock adds m.Quantity to the stock of m's variant, or of its product
+// when m has no variant, and appends m to the ledger with the resulting
+// balance. A movement that would take stock below zero fails with an
+// InsufficientStockError; a zero quantity records nothing.
+func moveStock(tx *sql.Tx, m models.StockMovement) (models.StockMovement, error) {
+	if m.Quantity == 0 {
+		return m, nil
+	}
+
+	var nama string
+	var err error
+	if m.VariantID != 0 {
+		err = tx.QueryRow(
+			`SELECT v.stok, p.nama FROM product_variants v JOIN products p ON p.id = v.product_id
+			WHERE v.id = $1 AND v.product_id = $2 FOR UPDATE OF v`,
+			m.VariantID, m.ProductID,
+		).Scan(&m.StokAfter, &nama)
+		err = mapError(err, ErrVariantNotFound)
+	} else {
+		err = tx.QueryRow("SELECT stok, nama FROM products WHERE id = $1 FOR UPDATE", m.ProductID).Scan(&m.StokAfter, &nama)
+		err = mapError(err, ErrProductNotFound)
+	}
+	if err != nil {
+		return m, err
+	}
+
+	if m.StokAfter+m.Quantity < 0 {
+		return m, &InsufficientStockError{Items: []StockShortage{{
+			ProductID: m.ProductID,
+			VariantID: m.VariantID,
+			Nama:      nama,
+			Requested: -m.Quantity,
+			Available: m.StokAfter,
+		}}}
+	}
+	m.StokAfter += m.Quantity
+
+	table := "products"
+	id := m.ProductID
+	if m.VariantID != 0 {
+		table, id = "product_variants", m.VariantID
+	}
+	if _, err := tx.Exec("UPDATE "+table+" SET stok = $1 WHERE id = $2", m.StokAfter, id); err != nil {
+		return m, err
+	}
+
+	err = tx.QueryRow(
+		"INSERT INTO stock_movements (product_id, variant_id, type, quantity, stok_after, reason, reference, actor) VALUES ($1, NULLIF($2, 0), $3, $4, $5, $6, $7, $8) RETURNING id, created_at",
+		m.ProductID, m.VariantID, m.Type, m.Quantity, m.StokAfter, m.Reason, m.Reference, m.Actor,
+	).Scan(&m.ID, &m.CreatedAt)
+	return m, err
+}
+
+// countStock records the movement that brings a product or variant from its
+// current stock to counted, as when a stock count or import sets the level
+// outright. m.Quantity is ignored.
+func countStock(tx *sql.Tx, m models.StockMovement, counted int) error {
+	var current int
+	var err error
+	if m.VariantID != 0 {
+		err = tx.QueryRow("SELECT stok FROM product_variants WHERE id = $1 FOR UPDATE", m.VariantID).Scan(&current)
+	} else {
+		err = tx.QueryRow("SELECT stok FROM products WHERE id = $1 FOR UPDATE", m.ProductID).Scan(&current)
+	}
+	if err != nil {
+		return err
+	}
+	m.Quantity = counted - current
+	_, err = moveStock(tx, m)
+	return err
+}
+
+// stockKey identifies the product or variant a stock movement applies to.
+type stockKey struct{ productID, variantID int }
+
+// moveStocks records one movement per key, variants first and each in ID
+// order, the order checkout locks rows in, so concurrent sales and reversals
+// cannot deadlock. template supplies every field but the product, variant
+// and quantity. The recorded movements are returned in that order.
+func moveStocks(tx *sql.Tx, quantities map[stockKey]int, template models.StockMovement) ([]models.StockMovement, error) {
+	keys := make([]stockKey, 0, len(quantities))
+	for key := range quantities {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if (a.variantID != 0) != (b.variantID != 0) {
+			return a.variantID != 0
+		}
+		if a.variantID != b.variantID {
+			return a.variantID < b.variantID
+		}
+		return a.productID < b.productID
+	})
+
+	movements := make([]models.StockMovement, 0, len(keys))
+	for _, key := range keys {
+		m := template
+		m.ProductID, m.VariantID, m.Quantity = key.productID, key.variantID, quantities[key]
+		m, err := moveStock(tx, m)
+		if err != nil {
+			return nil, err
+		}
+		movements = append(movements, m)
+	}
+	return movements, nil
+}
+
+// transactionReference is the ledger reference of stock moved by a sale or
+// by one of its reversals.
+func transactionReference(transactionID int) string {
+	return fmt.Sprintf("transaction:%d", transactionID)
+}
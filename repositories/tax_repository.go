@@ -0,0 +1,117 @@
+package repositories
+
+import (
+	"category-api/models"
+	"database/sql"
+)
+
+type TaxRepository interface {
+	GetAll() ([]models.TaxRate, error)
+	GetByID(id int) (models.TaxRate, error)
+	Create(t models.TaxRate) (models.TaxRate, error)
+	Update(id int, t models.TaxRate) (models.TaxRate, error)
+	Delete(id int) error
+}
+
+type taxRepository struct {
+	db *sql.DB
+}
+
+func NewTaxRepository(db *sql.DB) TaxRepository {
+	return &taxRepository{db}
+}
+
+const taxRateColumns = "id, name, rate, inclusive, is_default, created_at"
+
+func scanTaxRate(row rowScanner) (models.TaxRate, error) {
+	var t models.TaxRate
+	err := row.Scan(&t.ID, &t.Name, &t.Rate, &t.Inclusive, &t.Default, &t.CreatedAt)
+	return t, err
+}
+
+// GetAll returns every tax rate, the default first.
+func (r *taxRepository) GetAll() ([]models.TaxRate, error) {
+	rows, err := r.db.Query("SELECT " + taxRateColumns + " FROM tax_rates ORDER BY is_default DESC, name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rates := []models.TaxRate{}
+	for rows.Next() {
+		t, err := scanTaxRate(rows)
+		if err != nil {
+			return nil, err
+		}
+		rates = append(rates, t)
+	}
+	return rates, rows.Err()
+}
+
+func (r *taxRepository) GetByID(id int) (models.TaxRate, error) {
+	t, err := scanTaxRate(r.db.QueryRow("SELECT "+taxRateColumns+" FROM tax_rates WHERE id = $1", id))
+	return t, mapError(err, ErrTaxRateNotFound)
+}
+
+// Create adds a tax rate. A new default rate replaces the previous one.
+func (r *taxRepository) Create(t models.TaxRate) (models.TaxRate, error) {
+	var created models.TaxRate
+	err := runInTx(r.db, func(tx *sql.Tx) error {
+		if err := clearDefaultTaxRate(tx, t.Default, 0); err != nil {
+			return err
+		}
+		var err error
+		created, err = scanTaxRate(tx.QueryRow(
+			"INSERT INTO tax_rates (name, rate, inclusive, is_default) VALUES ($1, $2, $3, $4) RETURNING "+taxRateColumns,
+			t.Name, t.Rate, t.Inclusive, t.Default,
+		))
+		return err
+	})
+	if err != nil {
+		return t, mapError(err, nil)
+	}
+	return created, nil
+}
+
+// Update replaces a tax rate's settings. Past sales keep the rate they were
+// taxed at.
+func (r *taxRepository) Update(id int, t models.TaxRate) (models.TaxRate, error) {
+	var updated models.TaxRate
+	err := runInTx(r.db, func(tx *sql.Tx) error {
+		if err := clearDefaultTaxRate(tx, t.Default, id); err != nil {
+			return err
+		}
+		var err error
+		updated, err = scanTaxRate(tx.QueryRow(`
+			UPDATE tax_rates SET name = $1, rate = $2, inclusive = $3, is_default = $4
+			WHERE id = $5
+			RETURNING `+taxRateColumns,
+			t.Name, t.Rate, t.Inclusive, t.Default, id,
+		))
+		return err
+	})
+	if err != nil {
+		return t, mapError(err, ErrTaxRateNotFound)
+	}
+	return updated, nil
+}
+
+// Delete removes a tax rate. Products and categories using it fall back to
+// the rate they would otherwise inherit.
+func (r *taxRepository) Delete(id int) error {
+	res, err := r.db.Exec("DELETE FROM tax_rates WHERE id = $1", id)
+	if err != nil {
+		return mapError(err, nil)
+	}
+	return checkAffected(res, ErrTaxRateNotFound)
+}
+
+// clearDefaultTaxRate unsets the current default rate, unless it is the rate
+// with ID keep, when a rate is about to become the default.
+func clearDefaultTaxRate(tx *sql.Tx, isDefault bool, keep int) error {
+	if !isDefault {
+		return nil
+	}
+	_, err := tx.Exec("UPDATE tax_rates SET is_default = FALSE WHERE is_default AND id <> $1", keep)
+	return err
+}
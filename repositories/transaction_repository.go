@@ -3,14 +3,26 @@ package repositories
 import (
 	"category-api/models"
 	"database/sql"
+	"encoding/json"
+	"fmt"
 	"time"
+
+	"github.com/lib/pq"
 )
 
 type TransactionRepository interface {
-	CreateTransaction(items []models.CheckoutItem, products map[int]models.Produk) (models.Transaction, []models.TransactionDetail, error)
-	GetTodayRevenue() (int, error)
-	GetTodayTransactionCount() (int, error)
-	GetTodayBestSellingProduct() (models.BestSellingProduct, error)
+	CreateTransaction(req models.CheckoutRequest, idempotencyKey string) (models.CheckoutResponse, []models.LowStockItem, error)
+	List(filter models.TransactionFilter) ([]models.Transaction, error)
+	Each(filter models.TransactionFilter, fn func(models.Transaction) error) error
+	GetByID(id int) (models.Transaction, []models.TransactionDetail, error)
+	GetDiscounts(transactionID int) ([]models.AppliedDiscount, error)
+	GetRevenue(start, end time.Time) (int, error)
+	GetTransactionCount(start, end time.Time) (int, error)
+	GetBestSellingProduct(start, end time.Time) (models.BestSellingProduct, error)
+	GetDailySales(start, end time.Time, timezone string, cutoffHour int) ([]models.DailySales, error)
+	GetGrossProfit(start, end time.Time) (models.GrossProfitReport, error)
+	GetSalesBreakdown(start, end time.Time) (models.SalesBreakdown, error)
+	GetTaxSummary(start, end time.Time) (models.TaxReport, error)
 }
 
 type transactionRepository struct {
@@ -21,74 +33,653 @@ func NewTransactionRepository(db *sql.DB) TransactionRepository {
 	return &transactionRepository{db}
 }
 
-func (r *transactionRepository) CreateTransaction(items []models.CheckoutItem, products map[int]models.Produk) (models.Transaction, []models.TransactionDetail, error) {
-	// Start database transaction
-	tx, err := r.db.Begin()
+const transactionColumns = "id, gross_amount, discount_amount, tax_amount, total_amount, promo_code, status, created_at"
+
+func scanTransaction(row rowScanner) (models.Transaction, error) {
+	var t models.Transaction
+	err := row.Scan(&t.ID, &t.GrossAmount, &t.DiscountAmount, &t.TaxAmount, &t.TotalAmount, &t.PromoCode, &t.Status, &t.CreatedAt)
+	return t, err
+}
+
+// checkoutStatusCode is the HTTP status stored with the response of a
+// checkout made under an idempotency key: 201 Created.
+const checkoutStatusCode = 201
+
+// CreateTransaction sells the items of req in one database transaction,
+// applying its line and cart discounts, redeeming its promo code and taxing
+// every line at its product's tax rate. Besides the transaction, its lines
+// and the discounts applied, it returns the products and variants the sale
+// took down to or below their reorder point. A non-empty idempotencyKey,
+// reserved beforehand, is completed with the response in the same
+// transaction, so a committed sale always has its response stored.
+func (r *transactionRepository) CreateTransaction(req models.CheckoutRequest, idempotencyKey string) (models.CheckoutResponse, []models.LowStockItem, error) {
+	var sale models.CheckoutResponse
+	var lowStock []models.LowStockItem
+
+	err := runInTx(r.db, func(tx *sql.Tx) error {
+		// Reset results in case the transaction is being retried
+		sale = models.CheckoutResponse{}
+		lowStock = nil
+
+		items, err := resolveBarcodes(tx, req.Items)
+		if err != nil {
+			return err
+		}
+
+		// Lock the variant and product rows and check stock inside the
+		// transaction so concurrent checkouts cannot both sell the last unit
+		items, variants, err := lockVariants(tx, items)
+		if err != nil {
+			return err
+		}
+		products, err := lockProducts(tx, items)
+		if err != nil {
+			return err
+		}
+		if err := checkStock(items, products, variants); err != nil {
+			return err
+		}
+
+		// Price every item at its variant's price, or the product's when
+		// sold plainly, less its own discount
+		details := make([]models.TransactionDetail, len(items))
+		lineDiscounts := make([]int, len(items))
+		lineAmounts := make([]int, len(items))
+		var gross, spend int
+		for i, item := range items {
+			product := products[item.ProductID]
+			price := unitPrice(item, products, variants)
+			details[i] = models.TransactionDetail{
+				ProductID:   item.ProductID,
+				ProductName: product.Nama,
+				VariantID:   item.VariantID,
+				UnitPrice:   price,
+				UnitCost:    unitCost(item, products, variants),
+				Quantity:    item.Quantity,
+			}
+			if item.VariantID != 0 {
+				details[i].VariantName = variants[item.VariantID].Name(product.OptionAxes)
+			}
+			if item.Discount != nil {
+				lineDiscounts[i] = item.Discount.Amount(price * item.Quantity)
+			}
+			lineAmounts[i] = price*item.Quantity - lineDiscounts[i]
+			gross += price * item.Quantity
+			spend += lineAmounts[i]
+		}
+
+		// Cart discounts come off what is left after line discounts, the
+		// request's own first and then the promo code's
+		var cart []models.AppliedDiscount
+		remaining := spend
+		if req.Discount != nil {
+			amount := req.Discount.Amount(remaining)
+			cart = append(cart, models.AppliedDiscount{Scope: models.DiscountScopeCart, Discount: *req.Discount, Amount: amount})
+			remaining -= amount
+		}
+		var promoID int
+		if req.PromoCode != "" {
+			promo, err := redeemPromo(tx, req.PromoCode, spend)
+			if err != nil {
+				return err
+			}
+			amount := promo.Discount.Amount(remaining)
+			cart = append(cart, models.AppliedDiscount{
+				Scope:       models.DiscountScopeCart,
+				PromoCodeID: promo.ID,
+				Code:        promo.Code,
+				Discount:    promo.Discount,
+				Amount:      amount,
+			})
+			remaining -= amount
+			promoID = promo.ID
+			sale.Transaction.PromoCode = promo.Code
+		}
+		for i, share := range models.SpreadDiscount(spend-remaining, lineAmounts) {
+			details[i].Discount = lineDiscounts[i] + share
+			details[i].Subtotal = lineAmounts[i] - share
+		}
+
+		// Tax every line on what is left of it after discounts; exclusive
+		// tax is charged on top
+		rates, err := productTaxRates(tx, products)
+		if err != nil {
+			return err
+		}
+		var tax, total int
+		for i := range details {
+			detail := &details[i]
+			detail.Total = detail.Subtotal
+			if rate, ok := rates[detail.ProductID]; ok {
+				detail.SetTax(rate)
+			}
+			tax += detail.TaxAmount
+			total += detail.Total
+		}
+
+		// Insert transaction
+		sale.Transaction, err = scanTransaction(tx.QueryRow(
+			"INSERT INTO transactions (gross_amount, discount_amount, tax_amount, total_amount, promo_code_id, promo_code) VALUES ($1, $2, $3, $4, NULLIF($5, 0), $6) RETURNING "+transactionColumns,
+			gross, gross-remaining, tax, total, promoID, sale.Transaction.PromoCode,
+		))
+		if err != nil {
+			return err
+		}
+
+		// Insert transaction details, tallying the units sold per product and variant
+		sold := make(map[stockKey]int)
+		for i, item := range items {
+			detail := &details[i]
+			detail.TransactionID = sale.Transaction.ID
+			err = tx.QueryRow(
+				`INSERT INTO transaction_details (transaction_id, product_id, product_name, variant_id, variant_name, unit_price, unit_cost, quantity, discount, subtotal,
+					tax_rate_id, tax_name, tax_rate, tax_inclusive, tax_amount, total)
+				VALUES ($1, $2, $3, NULLIF($4, 0), $5, $6, $7, $8, $9, $10, NULLIF($11, 0), $12, $13, $14, $15, $16) RETURNING id`,
+				detail.TransactionID, detail.ProductID, detail.ProductName, detail.VariantID, detail.VariantName, detail.UnitPrice, detail.UnitCost, detail.Quantity, detail.Discount, detail.Subtotal,
+				detail.TaxRateID, detail.TaxName, detail.TaxRate, detail.TaxInclusive, detail.TaxAmount, detail.Total,
+			).Scan(&detail.ID)
+			if err != nil {
+				return err
+			}
+
+			sold[stockKey{item.ProductID, item.VariantID}] -= item.Quantity
+		}
+		sale.Details = details
+
+		// Record the discounts applied, line discounts first
+		discounts := make([]models.AppliedDiscount, 0, len(cart))
+		for i, item := range items {
+			if item.Discount != nil {
+				discounts = append(discounts, models.AppliedDiscount{
+					TransactionDetailID: details[i].ID,
+					Scope:               models.DiscountScopeLine,
+					Discount:            *item.Discount,
+					Amount:              lineDiscounts[i],
+				})
+			}
+		}
+		discounts = append(discounts, cart...)
+		for i := range discounts {
+			if err := insertDiscount(tx, sale.Transaction.ID, &discounts[i]); err != nil {
+				return err
+			}
+		}
+		sale.Discounts = discounts
+
+		// Take the sold units out of stock, recording them in the ledger
+		movements, err := moveStocks(tx, sold, models.StockMovement{
+			Type:      models.StockSale,
+			Reference: transactionReference(sale.Transaction.ID),
+			Actor:     req.Actor,
+		})
+		if err != nil {
+			return err
+		}
+		lowStock = crossedReorderPoint(movements, products, variants)
+
+		if idempotencyKey == "" {
+			return nil
+		}
+		body, err := json.Marshal(sale)
+		if err != nil {
+			return err
+		}
+		return completeIdempotencyKey(tx, idempotencyKey, checkoutStatusCode, body)
+	})
+	if err != nil {
+		return models.CheckoutResponse{}, nil, err
+	}
+
+	return sale, lowStock, nil
+}
+
+// productTaxRates returns the tax rate each locked product sells at: its
+// own, else that of its nearest category with one, else the default rate.
+// Products without any are left out and sell untaxed.
+func productTaxRates(tx *sql.Tx, products map[int]lockedProduct) (map[int]models.TaxRate, error) {
+	ids := make([]int64, 0, len(products))
+	for id := range products {
+		ids = append(ids, int64(id))
+	}
+
+	rows, err := tx.Query(`
+		WITH RECURSIVE chain AS (
+			SELECT id AS product_id, tax_rate_id, category_id, 0 AS depth
+			FROM products WHERE id = ANY($1)
+			UNION ALL
+			SELECT chain.product_id, c.tax_rate_id, c.parent_id, chain.depth + 1
+			FROM chain JOIN categories c ON c.id = chain.category_id
+			WHERE chain.tax_rate_id IS NULL AND chain.depth < $2
+		)
+		SELECT DISTINCT ON (chain.product_id) chain.product_id, t.id, t.name, t.rate, t.inclusive, t.is_default, t.created_at
+		FROM chain JOIN tax_rates t ON t.id = chain.tax_rate_id
+		ORDER BY chain.product_id, chain.depth
+	`, pq.Array(ids), maxCategoryDepth)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rates := make(map[int]models.TaxRate, len(products))
+	for rows.Next() {
+		var productID int
+		var t models.TaxRate
+		if err := rows.Scan(&productID, &t.ID, &t.Name, &t.Rate, &t.Inclusive, &t.Default, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		rates[productID] = t
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(rates) == len(products) {
+		return rates, nil
+	}
+
+	fallback, err := scanTaxRate(tx.QueryRow("SELECT " + taxRateColumns + " FROM tax_rates WHERE is_default"))
+	if err == sql.ErrNoRows {
+		return rates, nil
+	}
 	if err != nil {
-		return models.Transaction{}, nil, err
+		return nil, err
+	}
+	for id := range products {
+		if _, ok := rates[id]; !ok {
+			rates[id] = fallback
+		}
+	}
+	return rates, nil
+}
+
+// insertDiscount records a discount applied to transaction transactionID,
+// setting its ID.
+func insertDiscount(tx *sql.Tx, transactionID int, d *models.AppliedDiscount) error {
+	return tx.QueryRow(
+		"INSERT INTO transaction_discounts (transaction_id, transaction_detail_id, scope, promo_code_id, code, discount_type, discount_value, amount) VALUES ($1, NULLIF($2, 0), $3, NULLIF($4, 0), $5, $6, $7, $8) RETURNING id",
+		transactionID, d.TransactionDetailID, d.Scope, d.PromoCodeID, d.Code, d.Type, d.Value, d.Amount,
+	).Scan(&d.ID)
+}
+
+// crossedReorderPoint returns the products and variants whose stock went
+// from above their product's reorder point to at or below it.
+func crossedReorderPoint(movements []models.StockMovement, products map[int]lockedProduct, variants map[int]models.ProductVariant) []models.LowStockItem {
+	var items []models.LowStockItem
+	for _, m := range movements {
+		product := products[m.ProductID]
+		before := m.StokAfter - m.Quantity
+		if product.ReorderPoint == 0 || before <= product.ReorderPoint || m.StokAfter > product.ReorderPoint {
+			continue
+		}
+		item := models.LowStockItem{
+			ProductID:    m.ProductID,
+			VariantID:    m.VariantID,
+			Nama:         product.Nama,
+			SKU:          product.SKU,
+			CategoryID:   product.CategoryID,
+			Stok:         m.StokAfter,
+			ReorderPoint: product.ReorderPoint,
+		}
+		if m.VariantID != 0 {
+			v := variants[m.VariantID]
+			item.VariantName = v.Name(product.OptionAxes)
+			item.SKU = v.SKU
+		}
+		items = append(items, item)
 	}
+	return items
+}
 
-	// Calculate total amount
-	var totalAmount int
+// resolveBarcodes returns a copy of items where every item identified by a
+// barcode carries the ID of the product the barcode belongs to.
+func resolveBarcodes(tx *sql.Tx, items []models.CheckoutItem) ([]models.CheckoutItem, error) {
+	var codes []string
 	for _, item := range items {
-		product := products[item.ProductID]
-		totalAmount += product.Harga * item.Quantity
+		if item.Barcode != "" {
+			codes = append(codes, item.Barcode)
+		}
+	}
+	if len(codes) == 0 {
+		return items, nil
 	}
 
-	// Insert transaction
-	var transaction models.Transaction
-	err = tx.QueryRow(
-		"INSERT INTO transactions (total_amount) VALUES ($1) RETURNING id, total_amount, created_at",
-		totalAmount,
-	).Scan(&transaction.ID, &transaction.TotalAmount, &transaction.CreatedAt)
+	rows, err := tx.Query("SELECT code, product_id FROM product_barcodes WHERE code = ANY($1)", pq.Array(codes))
 	if err != nil {
-		tx.Rollback()
-		return models.Transaction{}, nil, err
+		return nil, err
 	}
+	defer rows.Close()
 
-	// Insert transaction details and update stock
-	var details []models.TransactionDetail
+	productIDs := make(map[string]int, len(codes))
+	for rows.Next() {
+		var code string
+		var productID int
+		if err := rows.Scan(&code, &productID); err != nil {
+			return nil, err
+		}
+		productIDs[code] = productID
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	resolved := make([]models.CheckoutItem, len(items))
+	for i, item := range items {
+		if item.Barcode != "" {
+			id, ok := productIDs[item.Barcode]
+			if !ok {
+				return nil, ErrProductNotFound.WithMessage(fmt.Sprintf("no product with barcode %q", item.Barcode))
+			}
+			item.ProductID = id
+		}
+		resolved[i] = item
+	}
+	return resolved, nil
+}
+
+// lockedProduct is a product row locked by a checkout.
+type lockedProduct struct {
+	models.Produk
+	hasVariants bool
+}
+
+// lockVariants loads the variants referenced by items with FOR UPDATE row
+// locks, taken in id order. It returns a copy of items in which every variant
+// item carries its product ID, and fails with ErrVariantNotFound when a
+// variant does not exist or belongs to another product.
+func lockVariants(tx *sql.Tx, items []models.CheckoutItem) ([]models.CheckoutItem, map[int]models.ProductVariant, error) {
+	var ids []int64
 	for _, item := range items {
-		product := products[item.ProductID]
-		subtotal := product.Harga * item.Quantity
-
-		// Insert detail
-		var detail models.TransactionDetail
-		err = tx.QueryRow(
-			"INSERT INTO transaction_details (transaction_id, product_id, quantity, subtotal) VALUES ($1, $2, $3, $4) RETURNING id, transaction_id, product_id, quantity, subtotal",
-			transaction.ID, item.ProductID, item.Quantity, subtotal,
-		).Scan(&detail.ID, &detail.TransactionID, &detail.ProductID, &detail.Quantity, &detail.Subtotal)
+		if item.VariantID != 0 {
+			ids = append(ids, int64(item.VariantID))
+		}
+	}
+	variants := make(map[int]models.ProductVariant)
+	if len(ids) == 0 {
+		return items, variants, nil
+	}
+
+	rows, err := tx.Query(
+		"SELECT "+variantColumns+" FROM product_variants WHERE id = ANY($1) ORDER BY id FOR UPDATE",
+		pq.Array(ids),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		v, err := scanVariant(rows)
 		if err != nil {
-			tx.Rollback()
-			return models.Transaction{}, nil, err
+			return nil, nil, err
 		}
-		details = append(details, detail)
+		variants[v.ID] = v
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
 
-		// Update product stock
-		_, err = tx.Exec(
-			"UPDATE products SET stok = stok - $1 WHERE id = $2",
-			item.Quantity, item.ProductID,
-		)
+	resolved := make([]models.CheckoutItem, len(items))
+	for i, item := range items {
+		if item.VariantID != 0 {
+			v, ok := variants[item.VariantID]
+			if !ok || (item.ProductID != 0 && item.ProductID != v.ProductID) {
+				return nil, nil, ErrVariantNotFound.WithMessage(fmt.Sprintf("variant %d not found", item.VariantID))
+			}
+			item.ProductID = v.ProductID
+		}
+		resolved[i] = item
+	}
+	return resolved, variants, nil
+}
+
+// lockProducts loads the products referenced by items with FOR UPDATE row
+// locks, taken in id order to avoid deadlocks between checkouts. It fails
+// with ErrProductNotFound for unknown or soft deleted products.
+func lockProducts(tx *sql.Tx, items []models.CheckoutItem) (map[int]lockedProduct, error) {
+	seen := make(map[int]bool)
+	var ids []int64
+	for _, item := range items {
+		if !seen[item.ProductID] {
+			seen[item.ProductID] = true
+			ids = append(ids, int64(item.ProductID))
+		}
+	}
+
+	rows, err := tx.Query(`
+		SELECT id, nama, harga, harga_pokok, stok, reorder_point, COALESCE(sku, ''), COALESCE(category_id, ''), option_axes,
+			EXISTS (SELECT 1 FROM product_variants v WHERE v.product_id = products.id)
+		FROM products WHERE id = ANY($1) AND deleted_at IS NULL ORDER BY id FOR UPDATE`,
+		pq.Array(ids),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	products := make(map[int]lockedProduct)
+	for rows.Next() {
+		var p lockedProduct
+		if err := rows.Scan(&p.ID, &p.Nama, &p.Harga, &p.HargaPokok, &p.Stok, &p.ReorderPoint, &p.SKU, &p.CategoryID, pq.Array(&p.OptionAxes), &p.hasVariants); err != nil {
+			return nil, err
+		}
+		products[p.ID] = p
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, id := range ids {
+		if _, ok := products[int(id)]; !ok {
+			return nil, ErrProductNotFound.WithMessage(fmt.Sprintf("product %d not found", id))
+		}
+	}
+	return products, nil
+}
+
+// checkStock makes sure every locked product and variant covers the quantity
+// requested across all items. It fails with ErrVariantRequired when a product
+// with variants is sold plainly, or an InsufficientStockError listing every
+// short product and variant.
+func checkStock(items []models.CheckoutItem, products map[int]lockedProduct, variants map[int]models.ProductVariant) error {
+	requested := make(map[stockKey]int)
+	var keys []stockKey
+	for _, item := range items {
+		if item.VariantID == 0 && products[item.ProductID].hasVariants {
+			return ErrVariantRequired.WithMessage(fmt.Sprintf("%q is sold by variant; variant_id is required", products[item.ProductID].Nama))
+		}
+		key := stockKey{item.ProductID, item.VariantID}
+		if _, ok := requested[key]; !ok {
+			keys = append(keys, key)
+		}
+		requested[key] += item.Quantity
+	}
+
+	var shortages []StockShortage
+	for _, key := range keys {
+		product := products[key.productID]
+		shortage := StockShortage{
+			ProductID: key.productID,
+			VariantID: key.variantID,
+			Nama:      product.Nama,
+			Requested: requested[key],
+			Available: product.Stok,
+		}
+		if key.variantID != 0 {
+			v := variants[key.variantID]
+			shortage.Nama += " (" + v.Name(product.OptionAxes) + ")"
+			shortage.Available = v.Stok
+		}
+		if shortage.Available < shortage.Requested {
+			shortages = append(shortages, shortage)
+		}
+	}
+	if len(shortages) > 0 {
+		return &InsufficientStockError{Items: shortages}
+	}
+	return nil
+}
+
+// unitPrice returns the price an item sells at.
+func unitPrice(item models.CheckoutItem, products map[int]lockedProduct, variants map[int]models.ProductVariant) int {
+	if item.VariantID != 0 {
+		return variants[item.VariantID].Harga
+	}
+	return products[item.ProductID].Harga
+}
+
+// unitCost returns the cost price of the unit an item sells.
+func unitCost(item models.CheckoutItem, products map[int]lockedProduct, variants map[int]models.ProductVariant) int {
+	if item.VariantID != 0 {
+		return variants[item.VariantID].HargaPokok
+	}
+	return products[item.ProductID].HargaPokok
+}
+
+// transactionQuery builds the WHERE clause selecting the transactions matching filter.
+func transactionQuery(filter models.TransactionFilter) queryBuilder {
+	var q queryBuilder
+	if !filter.StartDate.IsZero() {
+		q.where("created_at >= $%d", filter.StartDate)
+	}
+	if !filter.EndDate.IsZero() {
+		q.where("created_at < $%d", filter.EndDate)
+	}
+	if filter.MinAmount > 0 {
+		q.where("total_amount >= $%d", filter.MinAmount)
+	}
+	if filter.MaxAmount > 0 {
+		q.where("total_amount <= $%d", filter.MaxAmount)
+	}
+	if filter.ProductID > 0 {
+		q.where("EXISTS (SELECT 1 FROM transaction_details td WHERE td.transaction_id = transactions.id AND td.product_id = $%d)", filter.ProductID)
+	}
+	if filter.AfterID > 0 {
+		q.where("id < $%d", filter.AfterID)
+	}
+	return q
+}
+
+// List returns transactions matching filter, newest first.
+func (r *transactionRepository) List(filter models.TransactionFilter) ([]models.Transaction, error) {
+	q := transactionQuery(filter)
+	query := "SELECT " + transactionColumns + " FROM transactions" + q.whereClause() +
+		" ORDER BY id DESC LIMIT " + q.arg(filter.Limit)
+
+	rows, err := r.db.Query(query, q.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var transactions []models.Transaction
+	for rows.Next() {
+		t, err := scanTransaction(rows)
 		if err != nil {
-			tx.Rollback()
-			return models.Transaction{}, nil, err
+			return nil, err
 		}
+		transactions = append(transactions, t)
 	}
+	return transactions, rows.Err()
+}
 
-	// Commit transaction
-	if err := tx.Commit(); err != nil {
-		return models.Transaction{}, nil, err
+// Each calls fn for every transaction matching filter, oldest first, as rows
+// arrive from the database. It stops at the first error fn returns.
+func (r *transactionRepository) Each(filter models.TransactionFilter, fn func(models.Transaction) error) error {
+	q := transactionQuery(filter)
+	rows, err := r.db.Query("SELECT "+transactionColumns+" FROM transactions"+q.whereClause()+" ORDER BY id", q.args...)
+	if err != nil {
+		return err
 	}
+	defer rows.Close()
 
-	return transaction, details, nil
+	for rows.Next() {
+		t, err := scanTransaction(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(t); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
 }
 
-func (r *transactionRepository) GetTodayRevenue() (int, error) {
+// GetByID returns a transaction with its line items as they were sold.
+func (r *transactionRepository) GetByID(id int) (models.Transaction, []models.TransactionDetail, error) {
+	t, err := scanTransaction(r.db.QueryRow("SELECT "+transactionColumns+" FROM transactions WHERE id = $1", id))
+	if err != nil {
+		return t, nil, mapError(err, ErrTransactionNotFound)
+	}
+
+	rows, err := r.db.Query(`
+		SELECT id, transaction_id, COALESCE(product_id, 0), product_name, COALESCE(variant_id, 0), variant_name,
+			unit_price, unit_cost, quantity, discount, subtotal,
+			COALESCE(tax_rate_id, 0), tax_name, tax_rate, tax_inclusive, tax_amount, total
+		FROM transaction_details
+		WHERE transaction_id = $1
+		ORDER BY id
+	`, id)
+	if err != nil {
+		return t, nil, err
+	}
+	defer rows.Close()
+
+	var details []models.TransactionDetail
+	for rows.Next() {
+		var d models.TransactionDetail
+		if err := rows.Scan(&d.ID, &d.TransactionID, &d.ProductID, &d.ProductName, &d.VariantID, &d.VariantName, &d.UnitPrice, &d.UnitCost, &d.Quantity, &d.Discount, &d.Subtotal,
+			&d.TaxRateID, &d.TaxName, &d.TaxRate, &d.TaxInclusive, &d.TaxAmount, &d.Total); err != nil {
+			return t, nil, err
+		}
+		details = append(details, d)
+	}
+	return t, details, rows.Err()
+}
+
+// GetDiscounts returns the discounts applied to a transaction, line
+// discounts first.
+func (r *transactionRepository) GetDiscounts(transactionID int) ([]models.AppliedDiscount, error) {
+	rows, err := r.db.Query(`
+		SELECT id, COALESCE(transaction_detail_id, 0), scope, COALESCE(promo_code_id, 0), code, discount_type, discount_value, amount
+		FROM transaction_discounts
+		WHERE transaction_id = $1
+		ORDER BY id
+	`, transactionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	discounts := []models.AppliedDiscount{}
+	for rows.Next() {
+		var d models.AppliedDiscount
+		if err := rows.Scan(&d.ID, &d.TransactionDetailID, &d.Scope, &d.PromoCodeID, &d.Code, &d.Type, &d.Value, &d.Amount); err != nil {
+			return nil, err
+		}
+		discounts = append(discounts, d)
+	}
+	return discounts, rows.Err()
+}
+
+// The report queries below take a half-open [start, end) range. Voided
+// sales are excluded entirely; refunds are netted in the period they were
+// made, each refund row contributing a negative amount and no transaction.
+
+// netSalesQuery selects (created_at, amount, transactions) rows for sales and
+// refunds in [$1, $2). amount is what was charged, tax included.
+const netSalesQuery = `
+	SELECT created_at, total_amount AS amount, 1 AS transactions
+	FROM transactions
+	WHERE status <> 'voided' AND created_at >= $1 AND created_at < $2
+	UNION ALL
+	SELECT created_at, -amount, 0
+	FROM transaction_reversals
+	WHERE type = 'refund' AND created_at >= $1 AND created_at < $2`
+
+func (r *transactionRepository) GetRevenue(start, end time.Time) (int, error) {
 	var revenue sql.NullInt64
-	today := time.Now().Format("2006-01-02")
 	err := r.db.QueryRow(
-		"SELECT COALESCE(SUM(total_amount), 0) FROM transactions WHERE DATE(created_at) = $1",
-		today,
+		"SELECT COALESCE(SUM(amount), 0) FROM ("+netSalesQuery+") AS net_sales",
+		start, end,
 	).Scan(&revenue)
 	if err != nil {
 		return 0, err
@@ -96,31 +687,32 @@ func (r *transactionRepository) GetTodayRevenue() (int, error) {
 	return int(revenue.Int64), nil
 }
 
-func (r *transactionRepository) GetTodayTransactionCount() (int, error) {
+func (r *transactionRepository) GetTransactionCount(start, end time.Time) (int, error) {
 	var count int
-	today := time.Now().Format("2006-01-02")
 	err := r.db.QueryRow(
-		"SELECT COUNT(*) FROM transactions WHERE DATE(created_at) = $1",
-		today,
+		"SELECT COUNT(*) FROM transactions WHERE status <> 'voided' AND created_at >= $1 AND created_at < $2",
+		start, end,
 	).Scan(&count)
 	return count, err
 }
 
-func (r *transactionRepository) GetTodayBestSellingProduct() (models.BestSellingProduct, error) {
+// GetBestSellingProduct returns the product with the most units sold in
+// [start, end), named as on its latest line. Refunded units are netted in
+// the period of the refund, like the rest of the report. Lines whose
+// product row was removed, leaving product_id NULL, are grouped by name.
+func (r *transactionRepository) GetBestSellingProduct(start, end time.Time) (models.BestSellingProduct, error) {
 	var productName sql.NullString
 	var totalQty sql.NullInt64
-	today := time.Now().Format("2006-01-02")
 	err := r.db.QueryRow(`
-		SELECT p.nama, SUM(td.quantity) as total_qty
-		FROM transaction_details td
-		JOIN transactions t ON td.transaction_id = t.id
-		JOIN products p ON td.product_id = p.id
-		WHERE DATE(t.created_at) = $1
-		GROUP BY p.id, p.nama
+		SELECT (ARRAY_AGG(td.product_name ORDER BY td.id DESC))[1], SUM(ls.quantity) as total_qty
+		FROM (`+lineSalesQuery+`) AS ls
+		JOIN transaction_details td ON td.id = ls.detail_id
+		GROUP BY td.product_id, CASE WHEN td.product_id IS NULL THEN td.product_name END
+		HAVING SUM(ls.quantity) > 0
 		ORDER BY total_qty DESC
 		LIMIT 1
-	`, today).Scan(&productName, &totalQty)
-	
+	`, start, end).Scan(&productName, &totalQty)
+
 	if err == sql.ErrNoRows {
 		return models.BestSellingProduct{Nama: "-", QtyTerjual: 0}, nil
 	}
@@ -134,4 +726,158 @@ func (r *transactionRepository) GetTodayBestSellingProduct() (models.BestSelling
 		Nama:       productName.String,
 		QtyTerjual: int(totalQty.Int64),
 	}, nil
-}
\ No newline at end of file
+}
+
+// GetDailySales returns revenue and transaction count per business day,
+// where a day runs from cutoffHour to cutoffHour in timezone. Days without
+// sales are omitted.
+func (r *transactionRepository) GetDailySales(start, end time.Time, timezone string, cutoffHour int) ([]models.DailySales, error) {
+	rows, err := r.db.Query(`
+		SELECT DATE((created_at AT TIME ZONE $3) - make_interval(hours => $4)) AS tanggal, SUM(amount), SUM(transactions)
+		FROM (`+netSalesQuery+`) AS net_sales
+		GROUP BY tanggal
+		ORDER BY tanggal
+	`, start, end, timezone, cutoffHour)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var days []models.DailySales
+	for rows.Next() {
+		var day models.DailySales
+		var date time.Time
+		if err := rows.Scan(&date, &day.TotalRevenue, &day.TotalTransaksi); err != nil {
+			return nil, err
+		}
+		day.Tanggal = date.Format("2006-01-02")
+		days = append(days, day)
+	}
+	return days, rows.Err()
+}
+
+// lineSalesQuery selects (detail_id, quantity, gross, amount, tax, revenue,
+// cost) rows for sold lines of non-voided transactions and for refunded
+// lines, negated, in [$1, $2). gross is the line at list price and amount the
+// line after discounts, still at list price; tax is the tax charged on it and
+// revenue what was charged excluding that tax. Costs use the unit cost
+// snapshotted at sale time.
+const lineSalesQuery = `
+	SELECT td.id AS detail_id, td.quantity, td.unit_price * td.quantity AS gross, td.subtotal AS amount,
+		td.tax_amount AS tax, td.total - td.tax_amount AS revenue, td.unit_cost * td.quantity AS cost
+	FROM transaction_details td
+	JOIN transactions t ON t.id = td.transaction_id
+	WHERE t.status <> 'voided' AND t.created_at >= $1 AND t.created_at < $2
+	UNION ALL
+	SELECT ri.transaction_detail_id, -ri.quantity, -(td.unit_price * ri.quantity),
+		-(ri.amount - CASE WHEN td.tax_inclusive THEN 0 ELSE ri.tax_amount END),
+		-ri.tax_amount, -(ri.amount - ri.tax_amount), -(td.unit_cost * ri.quantity)
+	FROM transaction_reversal_items ri
+	JOIN transaction_reversals rv ON rv.id = ri.reversal_id
+	JOIN transaction_details td ON td.id = ri.transaction_detail_id
+	WHERE rv.type = 'refund' AND rv.created_at >= $1 AND rv.created_at < $2`
+
+// GetGrossProfit returns revenue, cost of goods sold and gross profit in
+// [start, end), in total and per product and category. Revenue excludes
+// tax, which is owed rather than earned. Products are grouped
+// by the name they were sold under; categories by the product's current
+// category.
+func (r *transactionRepository) GetGrossProfit(start, end time.Time) (models.GrossProfitReport, error) {
+	var report models.GrossProfitReport
+
+	rows, err := r.db.Query(`
+		SELECT COALESCE(td.product_id, 0), td.product_name, SUM(ls.quantity), SUM(ls.revenue), SUM(ls.cost)
+		FROM (`+lineSalesQuery+`) AS ls
+		JOIN transaction_details td ON td.id = ls.detail_id
+		GROUP BY td.product_id, td.product_name
+		ORDER BY SUM(ls.revenue) - SUM(ls.cost) DESC, td.product_name
+	`, start, end)
+	if err != nil {
+		return report, err
+	}
+	defer rows.Close()
+
+	var revenue, cogs int
+	for rows.Next() {
+		var p models.ProductGrossProfit
+		var amount, cost int
+		if err := rows.Scan(&p.ProductID, &p.Nama, &p.QtyTerjual, &amount, &cost); err != nil {
+			return report, err
+		}
+		p.GrossProfit = models.NewGrossProfit(amount, cost)
+		report.PerProduk = append(report.PerProduk, p)
+		revenue += amount
+		cogs += cost
+	}
+	if err := rows.Err(); err != nil {
+		return report, err
+	}
+	report.GrossProfit = models.NewGrossProfit(revenue, cogs)
+
+	rows, err = r.db.Query(`
+		SELECT COALESCE(c.id, ''), COALESCE(c.name, ''), SUM(ls.revenue), SUM(ls.cost)
+		FROM (`+lineSalesQuery+`) AS ls
+		JOIN transaction_details td ON td.id = ls.detail_id
+		LEFT JOIN products p ON p.id = td.product_id
+		LEFT JOIN categories c ON c.id = p.category_id
+		GROUP BY c.id, c.name
+		ORDER BY SUM(ls.revenue) - SUM(ls.cost) DESC, c.name
+	`, start, end)
+	if err != nil {
+		return report, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c models.CategoryGrossProfit
+		var amount, cost int
+		if err := rows.Scan(&c.CategoryID, &c.Name, &amount, &cost); err != nil {
+			return report, err
+		}
+		c.GrossProfit = models.NewGrossProfit(amount, cost)
+		report.PerKategori = append(report.PerKategori, c)
+	}
+	return report, rows.Err()
+}
+
+// GetSalesBreakdown returns gross sales, discounts and net sales in
+// [start, end). Refunded units take their list price out of gross sales and
+// their share of the discounts out of discounts.
+func (r *transactionRepository) GetSalesBreakdown(start, end time.Time) (models.SalesBreakdown, error) {
+	var b models.SalesBreakdown
+	err := r.db.QueryRow(
+		"SELECT COALESCE(SUM(gross), 0), COALESCE(SUM(amount), 0) FROM ("+lineSalesQuery+") AS ls",
+		start, end,
+	).Scan(&b.GrossSales, &b.NetSales)
+	b.Discounts = b.GrossSales - b.NetSales
+	return b, err
+}
+
+// GetTaxSummary returns the tax charged in [start, end) per tax rate, as the
+// rate was when each line was sold, and in total. Untaxed lines are left out.
+func (r *transactionRepository) GetTaxSummary(start, end time.Time) (models.TaxReport, error) {
+	report := models.TaxReport{PerTarif: []models.TaxSummary{}}
+	rows, err := r.db.Query(`
+		SELECT td.tax_name, td.tax_rate, td.tax_inclusive, SUM(ls.revenue), SUM(ls.tax)
+		FROM (`+lineSalesQuery+`) AS ls
+		JOIN transaction_details td ON td.id = ls.detail_id
+		WHERE td.tax_name <> ''
+		GROUP BY td.tax_name, td.tax_rate, td.tax_inclusive
+		ORDER BY td.tax_name, td.tax_rate, td.tax_inclusive
+	`, start, end)
+	if err != nil {
+		return report, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t models.TaxSummary
+		if err := rows.Scan(&t.Name, &t.Rate, &t.Inclusive, &t.TaxableAmount, &t.TaxAmount); err != nil {
+			return report, err
+		}
+		report.PerTarif = append(report.PerTarif, t)
+		report.TaxableAmount += t.TaxableAmount
+		report.TaxAmount += t.TaxAmount
+	}
+	return report, rows.Err()
+}
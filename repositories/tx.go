@@ -0,0 +1,51 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// maxTxAttempts bounds how often a transaction is replayed after a
+// serialization failure or deadlock before the error is returned.
+const maxTxAttempts = 3
+
+// runInTx runs fn inside a database transaction, committing on success and
+// rolling back on error. Transactions aborted by PostgreSQL because of a
+// serialization failure or deadlock are retried with a short backoff, so fn
+// must be safe to run more than once.
+func runInTx(db *sql.DB, fn func(tx *sql.Tx) error) error {
+	var err error
+	for attempt := 1; attempt <= maxTxAttempts; attempt++ {
+		err = runOnce(db, fn)
+		if err == nil || !isRetryable(err) {
+			return err
+		}
+		time.Sleep(time.Duration(attempt*attempt) * 10 * time.Millisecond)
+	}
+	return err
+}
+
+func runOnce(db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// isRetryable reports whether err is a serialization_failure (40001) or
+// deadlock_detected (40P01) error.
+func isRetryable(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+	return pqErr.Code == "40001" || pqErr.Code == "40P01"
+}
@@ -0,0 +1,109 @@
+package repositories
+
+import (
+	"category-api/models"
+	"database/sql"
+	"encoding/json"
+)
+
+type VariantRepository interface {
+	GetByProductID(productID int) ([]models.ProductVariant, error)
+	Create(v models.ProductVariant, actor string) (models.ProductVariant, error)
+	Update(productID, id int, v models.ProductVariant) (models.ProductVariant, error)
+	Delete(productID, id int) error
+}
+
+type variantRepository struct {
+	db *sql.DB
+}
+
+func NewVariantRepository(db *sql.DB) VariantRepository {
+	return &variantRepository{db}
+}
+
+const variantColumns = "id, product_id, COALESCE(sku, ''), options, harga, harga_pokok, stok"
+
+func scanVariant(row rowScanner) (models.ProductVariant, error) {
+	var v models.ProductVariant
+	var options []byte
+	if err := row.Scan(&v.ID, &v.ProductID, &v.SKU, &options, &v.Harga, &v.HargaPokok, &v.Stok); err != nil {
+		return v, err
+	}
+	v.SetMargin()
+	err := json.Unmarshal(options, &v.Options)
+	return v, err
+}
+
+// GetByProductID returns the variants of a product in creation order.
+func (r *variantRepository) GetByProductID(productID int) ([]models.ProductVariant, error) {
+	rows, err := r.db.Query("SELECT "+variantColumns+" FROM product_variants WHERE product_id = $1 ORDER BY id", productID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var variants []models.ProductVariant
+	for rows.Next() {
+		v, err := scanVariant(rows)
+		if err != nil {
+			return nil, err
+		}
+		variants = append(variants, v)
+	}
+	return variants, rows.Err()
+}
+
+// Create inserts a variant; its opening stock is recorded in the ledger as an
+// initial movement by actor.
+func (r *variantRepository) Create(v models.ProductVariant, actor string) (models.ProductVariant, error) {
+	options, err := json.Marshal(v.Options)
+	if err != nil {
+		return v, err
+	}
+	var created models.ProductVariant
+	err = runInTx(r.db, func(tx *sql.Tx) error {
+		var id int
+		err := tx.QueryRow(
+			"INSERT INTO product_variants (product_id, sku, options, harga, harga_pokok) VALUES ($1, NULLIF($2, ''), $3, $4, $5) RETURNING id",
+			v.ProductID, v.SKU, string(options), v.Harga, v.HargaPokok,
+		).Scan(&id)
+		if err != nil {
+			return err
+		}
+		_, err = moveStock(tx, models.StockMovement{ProductID: v.ProductID, VariantID: id, Type: models.StockInitial, Quantity: v.Stok, Actor: actor})
+		if err != nil {
+			return err
+		}
+		created, err = scanVariant(tx.QueryRow("SELECT "+variantColumns+" FROM product_variants WHERE id = $1", id))
+		return err
+	})
+	if err != nil {
+		return v, mapError(err, nil)
+	}
+	return created, nil
+}
+
+// Update replaces the SKU, options and prices of a variant. Stock only
+// changes through stock movements.
+func (r *variantRepository) Update(productID, id int, v models.ProductVariant) (models.ProductVariant, error) {
+	options, err := json.Marshal(v.Options)
+	if err != nil {
+		return v, err
+	}
+	updated, err := scanVariant(r.db.QueryRow(
+		"UPDATE product_variants SET sku = NULLIF($1, ''), options = $2, harga = $3, harga_pokok = $4 WHERE id = $5 AND product_id = $6 RETURNING "+variantColumns,
+		v.SKU, string(options), v.Harga, v.HargaPokok, id, productID,
+	))
+	if err != nil {
+		return v, mapError(err, ErrVariantNotFound)
+	}
+	return updated, nil
+}
+
+func (r *variantRepository) Delete(productID, id int) error {
+	res, err := r.db.Exec("DELETE FROM product_variants WHERE id = $1 AND product_id = $2", id, productID)
+	if err != nil {
+		return mapError(err, nil)
+	}
+	return checkAffected(res, ErrVariantNotFound)
+}
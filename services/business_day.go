@@ -0,0 +1,47 @@
+package services
+
+import "time"
+
+// BusinessDay maps calendar dates to the store's business days. A business
+// day starts at CutoffHour in the store timezone, so with a cutoff of 4 a
+// sale at 02:30 on the 2nd belongs to the business day of the 1st.
+//
+// Dates are represented as midnight UTC values carrying only the year, month
+// and day, as produced by parsing YYYY-MM-DD.
+type BusinessDay struct {
+	Location   *time.Location
+	CutoffHour int
+}
+
+// Start returns the instant at which the business day of date begins.
+func (b BusinessDay) Start(date time.Time) time.Time {
+	return time.Date(date.Year(), date.Month(), date.Day(), b.CutoffHour, 0, 0, 0, b.location())
+}
+
+// DateOf returns the business date that instant t falls on.
+func (b BusinessDay) DateOf(t time.Time) time.Time {
+	local := t.In(b.location()).Add(-time.Duration(b.CutoffHour) * time.Hour)
+	return time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// In returns instant t in the store timezone.
+func (b BusinessDay) In(t time.Time) time.Time {
+	return t.In(b.location())
+}
+
+// Today returns the current business date.
+func (b BusinessDay) Today() time.Time {
+	return b.DateOf(time.Now())
+}
+
+// TimezoneName returns the IANA name of the store timezone for use in SQL.
+func (b BusinessDay) TimezoneName() string {
+	return b.location().String()
+}
+
+func (b BusinessDay) location() *time.Location {
+	if b.Location == nil {
+		return time.UTC
+	}
+	return b.Location
+}
@@ -0,0 +1,260 @@
+package services
+
+import (
+	"category-api/models"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxCategoryIDLength and maxCategoryNameLength are the column sizes of the
+// categories table, in characters.
+const (
+	maxCategoryIDLength   = 50
+	maxCategoryNameLength = 100
+)
+
+// Import loads a category seed file and upserts its categories by ID in a
+// single transaction. Every category is first checked against the file and
+// the categories already stored: names must stay unique regardless of case,
+// slugs unique, and parents must exist without forming a cycle. When any
+// category is invalid nothing is written and the errors are returned.
+// Categories without a slug keep their current one or get one from their
+// name. A dry run only validates and reports what would be created or updated.
+func (s *categoryService) Import(r io.Reader, dryRun bool) (models.CategoryImportResult, error) {
+	result := models.CategoryImportResult{DryRun: dryRun, Errors: []models.CategoryImportError{}}
+
+	var seeds map[string]models.CategorySeed
+	if err := json.NewDecoder(r).Decode(&seeds); err != nil {
+		return result, ErrInvalidImportFile.WithMessage(fmt.Sprintf("invalid category seed: %v", err))
+	}
+	result.Total = len(seeds)
+	if result.Total == 0 {
+		return result, validationError("seed file contains no categories")
+	}
+
+	existing := make(map[string]models.Category)
+	err := s.repo.Each(models.CategoryFilter{IncludeDeleted: true}, func(c models.Category) error {
+		existing[c.ID] = c
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+
+	categories, errs := planCategoryImport(seeds, existing)
+	result.Errors = append(result.Errors, errs...)
+	if len(result.Errors) > 0 {
+		if dryRun {
+			return result, nil
+		}
+		return result, ErrImportRejected.WithDetails(result.Errors)
+	}
+
+	if dryRun {
+		for _, c := range categories {
+			if _, ok := existing[c.ID]; ok {
+				result.Updated++
+			} else {
+				result.Created++
+			}
+		}
+		return result, nil
+	}
+
+	result.Created, result.Updated, err = s.repo.Import(categories)
+	return result, categoryWriteError(err)
+}
+
+// ExportSeed returns the categories matching filter in the seed file format
+// read by Import.
+func (s *categoryService) ExportSeed(filter models.CategoryFilter) (map[string]models.CategorySeed, error) {
+	seeds := make(map[string]models.CategorySeed)
+	err := s.repo.Each(filter, func(c models.Category) error {
+		seeds[c.ID] = models.CategorySeed{
+			ID:          c.ID,
+			Name:        c.Name,
+			Slug:        c.Slug,
+			Description: c.Description,
+			ParentID:    c.ParentID,
+		}
+		return nil
+	})
+	return seeds, err
+}
+
+// planCategoryImport validates seeds against the existing categories, deleted
+// ones included, and returns them as categories ordered parents first, or
+// the errors of every invalid seed sorted by ID.
+func planCategoryImport(seeds map[string]models.CategorySeed, existing map[string]models.Category) ([]models.Category, []models.CategoryImportError) {
+	var errs []models.CategoryImportError
+	reject := func(id, message string) {
+		errs = append(errs, models.CategoryImportError{ID: id, Message: message})
+	}
+
+	keys := make([]string, 0, len(seeds))
+	for key := range seeds {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	// The categories as they will be once the import is written: every
+	// stored category, overwritten by the seeds.
+	final := make(map[string]models.Category, len(existing)+len(seeds))
+	for id, c := range existing {
+		final[id] = c
+	}
+	imported := make([]models.Category, 0, len(seeds))
+	for _, key := range keys {
+		seed := seeds[key]
+		c := models.Category{
+			ID:          strings.TrimSpace(seed.ID),
+			Name:        strings.TrimSpace(seed.Name),
+			Description: seed.Description,
+			ParentID:    strings.TrimSpace(seed.ParentID),
+		}
+		if c.ID == "" {
+			c.ID = key
+		}
+		switch {
+		case c.ID != key:
+			reject(key, fmt.Sprintf("id %q does not match its key", c.ID))
+			continue
+		case utf8.RuneCountInString(c.ID) > maxCategoryIDLength || strings.Contains(c.ID, "/"):
+			reject(key, fmt.Sprintf("id must be at most %d characters without \"/\"", maxCategoryIDLength))
+			continue
+		case c.Name == "":
+			reject(key, "name is required")
+			continue
+		case utf8.RuneCountInString(c.Name) > maxCategoryNameLength:
+			reject(key, fmt.Sprintf("name must be at most %d characters", maxCategoryNameLength))
+			continue
+		}
+		if seed.Slug != "" {
+			if c.Slug = slugify(seed.Slug); c.Slug == "" {
+				reject(key, "slug must contain letters or digits")
+				continue
+			}
+		} else {
+			c.Slug = existing[c.ID].Slug
+		}
+		final[c.ID] = c
+		imported = append(imported, c)
+	}
+
+	// Names are unique among live categories and slugs among all of them.
+	// Seeds that need a slug get theirs once every other slug is known.
+	conflict := func(field, value, id, other string) {
+		if _, ok := seeds[id]; !ok {
+			id, other = other, id
+		}
+		reject(id, fmt.Sprintf("%s %q is also used by category %s", field, value, other))
+	}
+	names := make(map[string]string)
+	slugs := make(map[string]string)
+	for _, id := range sortedCategoryIDs(final) {
+		c := final[id]
+		if c.DeletedAt == nil {
+			if other, ok := names[strings.ToLower(c.Name)]; ok {
+				conflict("name", c.Name, id, other)
+			} else {
+				names[strings.ToLower(c.Name)] = id
+			}
+		}
+		if c.Slug == "" {
+			continue
+		}
+		if other, ok := slugs[c.Slug]; ok {
+			conflict("slug", c.Slug, id, other)
+		} else {
+			slugs[c.Slug] = id
+		}
+	}
+	for i, c := range imported {
+		if c.Slug != "" {
+			continue
+		}
+		base := slugify(c.Name)
+		if base == "" {
+			base = "category"
+		}
+		slug := base
+		for n := 2; slugs[slug] != ""; n++ {
+			slug = base + "-" + strconv.Itoa(n)
+		}
+		slugs[slug] = c.ID
+		imported[i].Slug = slug
+		final[c.ID] = imported[i]
+	}
+
+	for _, c := range imported {
+		if c.ParentID == "" {
+			continue
+		}
+		parent, ok := final[c.ParentID]
+		switch {
+		case !ok || parent.DeletedAt != nil:
+			reject(c.ID, fmt.Sprintf("parent_id %q does not reference an existing category", c.ParentID))
+		case nestsUnderItself(final, c.ID):
+			reject(c.ID, "parent_id nests the category under itself or one of its subcategories")
+		}
+	}
+
+	if len(errs) > 0 {
+		sort.SliceStable(errs, func(i, j int) bool { return errs[i].ID < errs[j].ID })
+		return nil, errs
+	}
+	return parentsFirst(imported), nil
+}
+
+// sortedCategoryIDs returns the keys of categories in order.
+func sortedCategoryIDs(categories map[string]models.Category) []string {
+	ids := make([]string, 0, len(categories))
+	for id := range categories {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// nestsUnderItself reports whether following the parents of category id
+// leads back to it.
+func nestsUnderItself(categories map[string]models.Category, id string) bool {
+	for parent, depth := categories[id].ParentID, 0; parent != "" && depth < len(categories); depth++ {
+		if parent == id {
+			return true
+		}
+		parent = categories[parent].ParentID
+	}
+	return false
+}
+
+// parentsFirst orders categories so that each comes after its parent when
+// both are in the list, keeping the original order otherwise.
+func parentsFirst(categories []models.Category) []models.Category {
+	byID := make(map[string]models.Category, len(categories))
+	for _, c := range categories {
+		byID[c.ID] = c
+	}
+	ordered := make([]models.Category, 0, len(categories))
+	added := make(map[string]bool, len(categories))
+	var add func(c models.Category)
+	add = func(c models.Category) {
+		if added[c.ID] {
+			return
+		}
+		added[c.ID] = true
+		if parent, ok := byID[c.ParentID]; ok {
+			add(parent)
+		}
+		ordered = append(ordered, c)
+	}
+	for _, c := range categories {
+		add(c)
+	}
+	return ordered
+}
@@ -1,48 +1,302 @@
 package services
 
 import (
+	"category-api/apperrors"
 	"category-api/models"
 	"category-api/repositories"
+	"errors"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/google/uuid"
 )
 
+var (
+	// ErrInvalidParentCategory is returned when parent_id does not reference an existing category.
+	ErrInvalidParentCategory = apperrors.Unprocessable("invalid_parent_category", "parent_id does not reference an existing category")
+	// ErrCategoryCycle is returned when a category would be nested under itself.
+	ErrCategoryCycle = repositories.ErrCategoryCycle
+	// ErrCategoryNameTaken is returned when another category already has the name, ignoring case.
+	ErrCategoryNameTaken = apperrors.Conflict("category_name_taken", "a category with this name already exists")
+	// ErrCategorySlugTaken is returned when another category already has the slug.
+	ErrCategorySlugTaken = apperrors.Conflict("category_slug_taken", "a category with this slug already exists")
+	// ErrInvalidReassignTarget is returned when reassign_to is missing or lies inside the deleted category.
+	ErrInvalidReassignTarget = apperrors.Unprocessable("invalid_reassign_target", "reassign_to must be another existing category outside the one being deleted")
+)
+
+// slugSeparators matches the runs of characters a slug replaces with "-".
+var slugSeparators = regexp.MustCompile(`[^a-z0-9]+`)
+
+// maxSlugLength keeps generated slugs, numeric suffix included, within the schema.
+const maxSlugLength = 100
+
 type CategoryService interface {
-	GetAll() ([]models.Category, error)
+	GetAll(filter models.CategoryFilter) ([]models.Category, int, error)
+	Export(filter models.CategoryFilter, fn func(models.Category) error) error
+	ExportSeed(filter models.CategoryFilter) (map[string]models.CategorySeed, error)
+	Import(r io.Reader, dryRun bool) (models.CategoryImportResult, error)
 	GetByID(id string) (models.Category, error)
+	GetBySlug(slug string) (models.Category, error)
+	Tree() ([]models.CategoryNode, error)
 	Create(c models.Category) (models.Category, error)
 	Update(id string, c models.Category) (models.Category, error)
-	Delete(id string) error
+	Delete(id string, opts models.CategoryDeleteOptions) error
+	Restore(id string) (models.Category, error)
+	GetProducts(id string, filter models.ProductFilter) ([]models.Produk, int, error)
 }
 
 type categoryService struct {
-	repo repositories.CategoryRepository
+	repo        repositories.CategoryRepository
+	productRepo repositories.ProductRepository
 }
 
-func NewCategoryService(repo repositories.CategoryRepository) CategoryService {
-	return &categoryService{repo}
+func NewCategoryService(repo repositories.CategoryRepository, productRepo repositories.ProductRepository) CategoryService {
+	return &categoryService{repo, productRepo}
 }
 
-func (s *categoryService) GetAll() ([]models.Category, error) {
-	return s.repo.GetAll()
+func (s *categoryService) GetAll(filter models.CategoryFilter) ([]models.Category, int, error) {
+	filter.Normalize()
+	return s.repo.GetAll(filter)
 }
 
+// Export streams every category matching filter to fn.
+func (s *categoryService) Export(filter models.CategoryFilter, fn func(models.Category) error) error {
+	return s.repo.Each(filter, fn)
+}
+
+// GetByID returns a category with its breadcrumb path.
 func (s *categoryService) GetByID(id string) (models.Category, error) {
-	return s.repo.GetByID(id)
+	return s.withPath(s.repo.GetByID(id))
+}
+
+// GetBySlug returns the category with the given URL slug and its breadcrumb path.
+func (s *categoryService) GetBySlug(slug string) (models.Category, error) {
+	return s.withPath(s.repo.GetBySlug(slug))
+}
+
+// withPath fills in the breadcrumb path of a category returned by the repository.
+func (s *categoryService) withPath(c models.Category, err error) (models.Category, error) {
+	if err != nil {
+		return c, err
+	}
+	c.Path, err = s.repo.GetPath(c.ID)
+	return c, err
+}
+
+// Tree returns every category that is not deleted, nested under its parent
+// and sorted by name. Categories whose parent is deleted become roots.
+func (s *categoryService) Tree() ([]models.CategoryNode, error) {
+	var categories []models.Category
+	err := s.repo.Each(models.CategoryFilter{Sort: "name"}, func(c models.Category) error {
+		categories = append(categories, c)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return buildCategoryTree(categories), nil
 }
 
+// buildCategoryTree nests categories under their parents, keeping their
+// order among siblings.
+func buildCategoryTree(categories []models.Category) []models.CategoryNode {
+	known := make(map[string]bool, len(categories))
+	for _, c := range categories {
+		known[c.ID] = true
+	}
+	children := make(map[string][]models.Category)
+	var roots []models.Category
+	for _, c := range categories {
+		if c.ParentID == "" || !known[c.ParentID] {
+			roots = append(roots, c)
+		} else {
+			children[c.ParentID] = append(children[c.ParentID], c)
+		}
+	}
+
+	var build func(level []models.Category) []models.CategoryNode
+	build = func(level []models.Category) []models.CategoryNode {
+		nodes := make([]models.CategoryNode, len(level))
+		for i, c := range level {
+			nodes[i] = models.CategoryNode{Category: c, Children: build(children[c.ID])}
+		}
+		return nodes
+	}
+	return build(roots)
+}
+
+// Create adds a category. Its slug is derived from the name unless one is
+// given, and numbered (kopi-2, kopi-3, ...) when already taken.
 func (s *categoryService) Create(c models.Category) (models.Category, error) {
+	c.Name = strings.TrimSpace(c.Name)
+	c.ParentID = strings.TrimSpace(c.ParentID)
+	if c.Name == "" {
+		return c, validationError("name is required")
+	}
+	if c.Slug != "" {
+		if c.Slug = slugify(c.Slug); c.Slug == "" {
+			return c, validationError("slug must contain letters or digits")
+		}
+	} else {
+		slug, err := s.uniqueSlug(slugify(c.Name))
+		if err != nil {
+			return c, err
+		}
+		c.Slug = slug
+	}
 	// Generate UUID here if not present
 	if c.ID == "" {
 		c.ID = uuid.New().String()
 	}
-	return s.repo.Create(c)
+	if c.ParentID != "" {
+		if _, err := s.parentPath(c.ParentID); err != nil {
+			return c, err
+		}
+	}
+	created, err := s.repo.Create(c)
+	return s.withPath(created, categoryWriteError(err))
 }
 
+// Update replaces a category. Moving it under a new parent is rejected when
+// the parent is the category itself or one of its subcategories; the
+// repository checks this again, deleted categories included, while holding
+// the rows involved. The slug only changes when a new one is given, so
+// existing URLs keep working.
 func (s *categoryService) Update(id string, c models.Category) (models.Category, error) {
-	return s.repo.Update(id, c)
+	c.Name = strings.TrimSpace(c.Name)
+	c.ParentID = strings.TrimSpace(c.ParentID)
+	if c.Name == "" {
+		return c, validationError("name is required")
+	}
+	if c.Slug != "" {
+		if c.Slug = slugify(c.Slug); c.Slug == "" {
+			return c, validationError("slug must contain letters or digits")
+		}
+	}
+	if c.ParentID != "" {
+		inside, err := s.inSubtree(id, c.ParentID)
+		if errors.Is(err, repositories.ErrCategoryNotFound) {
+			return c, ErrInvalidParentCategory
+		}
+		if err != nil {
+			return c, err
+		}
+		if inside {
+			return c, ErrCategoryCycle
+		}
+	}
+	updated, err := s.repo.Update(id, c)
+	return s.withPath(updated, categoryWriteError(err))
+}
+
+// parentPath returns the breadcrumb of a prospective parent category.
+func (s *categoryService) parentPath(parentID string) ([]models.CategoryRef, error) {
+	path, err := s.repo.GetPath(parentID)
+	if errors.Is(err, repositories.ErrCategoryNotFound) {
+		return nil, ErrInvalidParentCategory
+	}
+	return path, err
+}
+
+// inSubtree reports whether target is the category id or nested below it.
+// It fails with ErrCategoryNotFound when target does not exist.
+func (s *categoryService) inSubtree(id, target string) (bool, error) {
+	if target == id {
+		return true, nil
+	}
+	path, err := s.repo.GetPath(target)
+	if err != nil {
+		return false, err
+	}
+	for _, ancestor := range path {
+		if ancestor.ID == id {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Delete soft deletes a category. One that still has products or
+// subcategories needs opts to move them elsewhere or delete them too.
+func (s *categoryService) Delete(id string, opts models.CategoryDeleteOptions) error {
+	opts.ReassignTo = strings.TrimSpace(opts.ReassignTo)
+	if opts.ReassignTo != "" && opts.Cascade {
+		return validationError("reassign_to and cascade cannot be combined")
+	}
+	if opts.ReassignTo != "" {
+		inside, err := s.inSubtree(id, opts.ReassignTo)
+		if errors.Is(err, repositories.ErrCategoryNotFound) || inside {
+			return ErrInvalidReassignTarget
+		}
+		if err != nil {
+			return err
+		}
+	}
+	err := s.repo.Delete(id, opts)
+	if errors.Is(err, repositories.ErrCategoryCycle) {
+		return ErrInvalidReassignTarget.Wrap(err)
+	}
+	return err
+}
+
+// Restore undoes a soft delete. It fails with ErrCategoryCycle when the
+// category's parents lead back to it.
+func (s *categoryService) Restore(id string) (models.Category, error) {
+	restored, err := s.repo.Restore(id)
+	return s.withPath(restored, categoryWriteError(err))
 }
 
-func (s *categoryService) Delete(id string) error {
-	return s.repo.Delete(id)
+// uniqueSlug returns base, or its first numbered form not yet taken.
+func (s *categoryService) uniqueSlug(base string) (string, error) {
+	if base == "" {
+		base = "category"
+	}
+	taken, err := s.repo.GetSlugs(base)
+	if err != nil {
+		return "", err
+	}
+	slug := base
+	for n := 2; taken[slug]; n++ {
+		slug = base + "-" + strconv.Itoa(n)
+	}
+	return slug, nil
+}
+
+// slugify lowercases s and joins its runs of letters and digits with "-".
+func slugify(s string) string {
+	slug := strings.Trim(slugSeparators.ReplaceAllString(strings.ToLower(s), "-"), "-")
+	if len(slug) > maxSlugLength {
+		slug = strings.TrimRight(slug[:maxSlugLength], "-")
+	}
+	return slug
+}
+
+// categoryWriteError turns unique violations on the category name and slug,
+// and unknown tax rates, into their own errors.
+func categoryWriteError(err error) error {
+	if !errors.Is(err, repositories.ErrDuplicate) {
+		return taxRateWriteError(err)
+	}
+	details, _ := apperrors.From(err).Details.(map[string]string)
+	switch details["constraint"] {
+	case "categories_name_lower_key":
+		return ErrCategoryNameTaken.Wrap(err)
+	case "categories_slug_key":
+		return ErrCategorySlugTaken.Wrap(err)
+	}
+	return err
+}
+
+// GetProducts returns a page of the products linked to a category. The
+// category itself must exist so callers can tell an unknown category from an
+// empty one.
+func (s *categoryService) GetProducts(id string, filter models.ProductFilter) ([]models.Produk, int, error) {
+	if _, err := s.repo.GetByID(id); err != nil {
+		return nil, 0, err
+	}
+	filter.CategoryID = id
+	filter.Normalize()
+	return s.productRepo.GetAll(filter)
 }
@@ -0,0 +1,11 @@
+package services
+
+import "category-api/apperrors"
+
+// errValidation is the base of request validation failures detected by services.
+var errValidation = apperrors.BadRequest(apperrors.CodeValidation, "validation failed")
+
+// validationError returns a validation_error with the given message.
+func validationError(message string) error {
+	return errValidation.WithMessage(message)
+}
@@ -0,0 +1,356 @@
+package services
+
+import (
+	"category-api/apperrors"
+	"category-api/models"
+	"category-api/repositories"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Import file formats accepted by ProductService.Import.
+const (
+	ImportFormatCSV  = "csv"
+	ImportFormatJSON = "json"
+)
+
+var (
+	// ErrInvalidImportFile is returned when an import file cannot be read at all.
+	ErrInvalidImportFile = apperrors.BadRequest("invalid_import_file", "invalid import file")
+	// ErrImportRejected is returned when an import has invalid rows; its details list them.
+	ErrImportRejected = apperrors.Unprocessable("import_rejected", "import has invalid rows; nothing was imported")
+)
+
+// importColumns are the CSV columns an import file may contain. barcodes
+// holds several codes separated by "|". id is accepted so exported files can
+// be imported again, but ignored: products are matched by sku.
+var importColumns = map[string]bool{
+	"id":            true,
+	"sku":           true,
+	"nama":          true,
+	"harga":         true,
+	"harga_pokok":   true,
+	"stok":          true,
+	"reorder_point": true,
+	"category_id":   true,
+	"barcodes":      true,
+}
+
+// Import loads products from a CSV or JSON file. Every row is validated
+// first; when any row is invalid nothing is written and the row errors are
+// returned. Rows are upserted by SKU in a single transaction, updating only
+// the fields the file gives, and stock changes are recorded as import
+// movements by actor. A dry run only
+// validates and reports what would be created or updated.
+func (s *productService) Import(r io.Reader, format string, dryRun bool, actor string) (models.ImportResult, error) {
+	result := models.ImportResult{DryRun: dryRun, Errors: []models.ImportRowError{}}
+
+	rows, rowErrors, err := parseImport(r, format)
+	if err != nil {
+		return result, err
+	}
+	result.Total = len(rows) + len(rowErrors)
+	if result.Total == 0 {
+		return result, validationError("import file contains no products")
+	}
+	result.Errors = append(result.Errors, rowErrors...)
+
+	valid, err := s.validateImport(rows)
+	if err != nil {
+		return result, err
+	}
+	result.Errors = append(result.Errors, valid...)
+
+	var existing map[string]int
+	if len(result.Errors) == 0 {
+		var skus []string
+		for _, row := range rows {
+			if row.Produk.SKU != "" {
+				skus = append(skus, row.Produk.SKU)
+			}
+		}
+		if existing, err = s.repo.GetIDsBySKU(skus); err != nil {
+			return result, err
+		}
+		taken, err := s.barcodeConflicts(rows, existing)
+		if err != nil {
+			return result, err
+		}
+		result.Errors = append(result.Errors, taken...)
+	}
+	sortRowErrors(result.Errors)
+
+	if len(result.Errors) > 0 {
+		if dryRun {
+			return result, nil
+		}
+		return result, ErrImportRejected.WithDetails(result.Errors)
+	}
+
+	if dryRun {
+		for _, row := range rows {
+			if _, ok := existing[row.Produk.SKU]; ok && row.Produk.SKU != "" {
+				result.Updated++
+			} else {
+				result.Created++
+			}
+		}
+		return result, nil
+	}
+
+	result.Created, result.Updated, err = s.repo.Import(rows, actor)
+	var rowErr *repositories.RowError
+	if errors.As(err, &rowErr) {
+		var appErr *apperrors.Error
+		if errors.As(rowErr.Err, &appErr) {
+			result.Errors = []models.ImportRowError{{Line: rowErr.Line, Message: appErr.Message}}
+			return result, ErrImportRejected.WithDetails(result.Errors).Wrap(err)
+		}
+	}
+	return result, err
+}
+
+// validateImport normalizes rows in place and returns an error for every row
+// that is invalid on its own, references an unknown category, or repeats the
+// SKU or a barcode of an earlier row.
+func (s *productService) validateImport(rows []models.ImportRow) ([]models.ImportRowError, error) {
+	var rowErrors []models.ImportRowError
+	categories := make(map[string]error)
+	skuLines := make(map[string]int)
+	barcodeLines := make(map[string]int)
+
+	for i := range rows {
+		row := &rows[i]
+		row.Produk = normalizeProduk(row.Produk)
+		p := row.Produk
+		reject := func(message string) {
+			rowErrors = append(rowErrors, models.ImportRowError{Line: row.Line, Message: message})
+		}
+
+		if err := validateProduk(p); err != nil {
+			reject(apperrors.From(err).Message)
+			continue
+		}
+		if len(p.OptionAxes) > 0 || len(p.Variants) > 0 {
+			reject("variants cannot be imported")
+			continue
+		}
+		if p.CategoryID != "" {
+			err, checked := categories[p.CategoryID]
+			if !checked {
+				err = s.checkCategory(p.CategoryID)
+				categories[p.CategoryID] = err
+			}
+			if errors.Is(err, ErrInvalidCategory) {
+				reject(fmt.Sprintf("category %q does not exist", p.CategoryID))
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		if p.SKU != "" {
+			if line, ok := skuLines[p.SKU]; ok {
+				reject(fmt.Sprintf("sku %q is already used on line %d", p.SKU, line))
+				continue
+			}
+			skuLines[p.SKU] = row.Line
+		}
+		for _, code := range p.Barcodes {
+			if line, ok := barcodeLines[code]; ok {
+				reject(fmt.Sprintf("barcode %q is already used on line %d", code, line))
+				break
+			}
+			barcodeLines[code] = row.Line
+		}
+	}
+	return rowErrors, nil
+}
+
+// barcodeConflicts returns an error for every row listing a barcode that
+// already belongs to another product, deleted or not, than the one the row
+// updates. existing maps the SKUs of the rows to the products they update.
+func (s *productService) barcodeConflicts(rows []models.ImportRow, existing map[string]int) ([]models.ImportRowError, error) {
+	var codes []string
+	for _, row := range rows {
+		codes = append(codes, row.Produk.Barcodes...)
+	}
+	if len(codes) == 0 {
+		return nil, nil
+	}
+	owners, err := s.repo.GetIDsByBarcode(codes)
+	if err != nil {
+		return nil, err
+	}
+
+	var rowErrors []models.ImportRowError
+	for _, row := range rows {
+		for _, code := range row.Produk.Barcodes {
+			if owner, ok := owners[code]; ok && owner != existing[row.Produk.SKU] {
+				rowErrors = append(rowErrors, models.ImportRowError{
+					Line:    row.Line,
+					Message: fmt.Sprintf("barcode %q already belongs to product %d", code, owner),
+				})
+				break
+			}
+		}
+	}
+	return rowErrors, nil
+}
+
+// parseImport reads the rows of an import file. Rows that cannot be decoded
+// are returned as row errors; a file that cannot be read at all is an
+// ErrInvalidImportFile.
+func parseImport(r io.Reader, format string) ([]models.ImportRow, []models.ImportRowError, error) {
+	switch format {
+	case ImportFormatCSV:
+		return parseImportCSV(r)
+	case ImportFormatJSON:
+		return parseImportJSON(r)
+	default:
+		return nil, nil, ErrInvalidImportFile.WithMessage(fmt.Sprintf("unsupported import format %q", format))
+	}
+}
+
+func parseImportCSV(r io.Reader) ([]models.ImportRow, []models.ImportRowError, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, ErrInvalidImportFile.WithMessage(err.Error())
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if !importColumns[name] {
+			return nil, nil, ErrInvalidImportFile.WithMessage(fmt.Sprintf("unknown column %q", name))
+		}
+		columns[name] = i
+	}
+	if _, ok := columns["nama"]; !ok {
+		return nil, nil, ErrInvalidImportFile.WithMessage(`missing column "nama"`)
+	}
+	fields := make(map[string]bool, len(columns))
+	for name := range columns {
+		fields[name] = true
+	}
+
+	var rows []models.ImportRow
+	var rowErrors []models.ImportRowError
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, ErrInvalidImportFile.WithMessage(err.Error())
+		}
+		line, _ := reader.FieldPos(0)
+		if len(record) != len(header) {
+			rowErrors = append(rowErrors, models.ImportRowError{
+				Line:    line,
+				Message: fmt.Sprintf("expected %d fields, got %d", len(header), len(record)),
+			})
+			continue
+		}
+
+		p, err := produkFromRecord(record, columns)
+		if err != nil {
+			rowErrors = append(rowErrors, models.ImportRowError{Line: line, Message: err.Error()})
+			continue
+		}
+		rows = append(rows, models.ImportRow{Line: line, Produk: p, Fields: fields})
+	}
+	return rows, rowErrors, nil
+}
+
+// produkFromRecord builds a product from a CSV record. Columns the file
+// leaves out are not updated; empty numeric cells read as 0, and an empty
+// barcodes cell leaves existing barcodes untouched.
+func produkFromRecord(record []string, columns map[string]int) (models.Produk, error) {
+	field := func(name string) string {
+		if i, ok := columns[name]; ok {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+	number := func(name string) (int, error) {
+		v := field(name)
+		if v == "" {
+			return 0, nil
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return 0, fmt.Errorf("%s must be a whole number, got %q", name, v)
+		}
+		return n, nil
+	}
+
+	p := models.Produk{
+		Nama:       field("nama"),
+		SKU:        field("sku"),
+		CategoryID: field("category_id"),
+	}
+	var err error
+	if p.Harga, err = number("harga"); err != nil {
+		return p, err
+	}
+	if p.HargaPokok, err = number("harga_pokok"); err != nil {
+		return p, err
+	}
+	if p.Stok, err = number("stok"); err != nil {
+		return p, err
+	}
+	if p.ReorderPoint, err = number("reorder_point"); err != nil {
+		return p, err
+	}
+	if barcodes := field("barcodes"); barcodes != "" {
+		p.Barcodes = strings.Split(barcodes, "|")
+	}
+	return p, nil
+}
+
+// parseImportJSON reads a JSON array of products. Line is the 1-based
+// position of the element in the array, and Fields its keys.
+func parseImportJSON(r io.Reader) ([]models.ImportRow, []models.ImportRowError, error) {
+	var elements []json.RawMessage
+	if err := json.NewDecoder(r).Decode(&elements); err != nil {
+		return nil, nil, ErrInvalidImportFile.WithMessage("expected a JSON array of products")
+	}
+
+	var rows []models.ImportRow
+	var rowErrors []models.ImportRowError
+	for i, element := range elements {
+		var p models.Produk
+		var keys map[string]json.RawMessage
+		err := json.Unmarshal(element, &p)
+		if err == nil {
+			err = json.Unmarshal(element, &keys)
+		}
+		if err != nil {
+			rowErrors = append(rowErrors, models.ImportRowError{Line: i + 1, Message: "invalid product: " + err.Error()})
+			continue
+		}
+		fields := make(map[string]bool, len(keys))
+		for key := range keys {
+			fields[key] = true
+		}
+		rows = append(rows, models.ImportRow{Line: i + 1, Produk: p, Fields: fields})
+	}
+	return rows, rowErrors, nil
+}
+
+func sortRowErrors(rowErrors []models.ImportRowError) {
+	sort.SliceStable(rowErrors, func(i, j int) bool { return rowErrors[i].Line < rowErrors[j].Line })
+}
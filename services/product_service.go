@@ -1,42 +1,348 @@
 package services
 
 import (
+	"category-api/apperrors"
 	"category-api/models"
 	"category-api/repositories"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
 )
 
+// ErrInvalidCategory is returned when a product references a category that does not exist.
+var ErrInvalidCategory = apperrors.Unprocessable("invalid_category", "category_id does not reference an existing category")
+
+// ErrOptionAxesInUse is returned when changing the option axes of a product that already has variants.
+var ErrOptionAxesInUse = apperrors.Conflict("option_axes_in_use", "option_axes cannot change while the product has variants")
+
+// ErrStockNotEditable is returned when a product or variant update tries to set its stock directly.
+var ErrStockNotEditable = apperrors.Unprocessable("stock_not_editable", "stok cannot be edited directly; record a stock adjustment instead")
+
+// ErrSKUTaken is returned when another product, possibly a deleted one, already has the SKU.
+var ErrSKUTaken = apperrors.Conflict("sku_taken", "sku is already used by another product")
+
+// ErrBarcodeTaken is returned when another product, possibly a deleted one, already has one of the barcodes.
+var ErrBarcodeTaken = apperrors.Conflict("barcode_taken", "a barcode is already used by another product")
+
+// maxCodeLength is the longest SKU or barcode the products schema accepts.
+const maxCodeLength = 64
+
 type ProductService interface {
-	GetAll(name string) ([]models.Produk, error)
+	GetAll(filter models.ProductFilter) ([]models.Produk, int, error)
+	Export(filter models.ProductFilter, fn func(models.Produk) error) error
 	GetByID(id int) (models.Produk, error)
-	Create(p models.Produk) (models.Produk, error)
-	Update(id int, p models.Produk) (models.Produk, error)
+	GetByBarcode(code string) (models.Produk, error)
+	Create(p models.Produk, actor string) (models.Produk, error)
+	Update(id int, u models.ProdukUpdate) (models.Produk, error)
 	Delete(id int) error
+	Restore(id int) (models.Produk, error)
+	CreateVariant(productID int, v models.ProductVariant, actor string) (models.ProductVariant, error)
+	UpdateVariant(productID, id int, v models.ProductVariant) (models.ProductVariant, error)
+	DeleteVariant(productID, id int) error
+	Import(r io.Reader, format string, dryRun bool, actor string) (models.ImportResult, error)
+	AdjustStock(productID int, req models.StockAdjustmentRequest) (models.StockMovement, error)
+	GetStockMovements(filter models.StockMovementFilter) ([]models.StockMovement, int, error)
+	GetLowStock(categoryID string) ([]models.LowStockItem, error)
 }
 
 type productService struct {
-	repo repositories.ProductRepository
+	repo         repositories.ProductRepository
+	categoryRepo repositories.CategoryRepository
+	variantRepo  repositories.VariantRepository
+	stockRepo    repositories.StockRepository
+}
+
+func NewProductService(repo repositories.ProductRepository, categoryRepo repositories.CategoryRepository, variantRepo repositories.VariantRepository, stockRepo repositories.StockRepository) ProductService {
+	return &productService{repo, categoryRepo, variantRepo, stockRepo}
 }
 
-func NewProductService(repo repositories.ProductRepository) ProductService {
-	return &productService{repo}
+func (s *productService) GetAll(filter models.ProductFilter) ([]models.Produk, int, error) {
+	filter.Normalize()
+	return s.repo.GetAll(filter)
 }
 
-func (s *productService) GetAll(name string) ([]models.Produk, error) {
-	return s.repo.GetAll(name)
+// Export streams every product matching filter to fn.
+func (s *productService) Export(filter models.ProductFilter, fn func(models.Produk) error) error {
+	return s.repo.Each(filter, fn)
 }
 
+// GetByID returns a product together with its variants.
 func (s *productService) GetByID(id int) (models.Produk, error) {
-	return s.repo.GetByID(id)
+	p, err := s.repo.GetByID(id)
+	if err != nil {
+		return p, err
+	}
+	p.Variants, err = s.variantRepo.GetByProductID(id)
+	return p, err
+}
+
+func (s *productService) GetByBarcode(code string) (models.Produk, error) {
+	return s.repo.GetByBarcode(code)
 }
 
-func (s *productService) Create(p models.Produk) (models.Produk, error) {
-	return s.repo.Create(p)
+// Create adds a product; its opening stock is recorded as a movement by actor.
+func (s *productService) Create(p models.Produk, actor string) (models.Produk, error) {
+	p = normalizeProduk(p)
+	if err := validateProduk(p); err != nil {
+		return p, err
+	}
+	if err := s.checkCategory(p.CategoryID); err != nil {
+		return p, err
+	}
+	created, err := s.repo.Create(p, actor)
+	return created, s.productWriteError(0, p, err)
 }
 
-func (s *productService) Update(id int, p models.Produk) (models.Produk, error) {
-	return s.repo.Update(id, p)
+// Update replaces a product. stok may be left out or repeat the current
+// stock, but changing it, to 0 included, takes a stock adjustment.
+func (s *productService) Update(id int, u models.ProdukUpdate) (models.Produk, error) {
+	p := normalizeProduk(u.Produk)
+	if err := validateProduk(p); err != nil {
+		return p, err
+	}
+	if err := s.checkCategory(p.CategoryID); err != nil {
+		return p, err
+	}
+	current, err := s.repo.GetByID(id)
+	if err != nil {
+		return p, err
+	}
+	if u.Stok != nil && *u.Stok != current.Stok {
+		return p, ErrStockNotEditable
+	}
+	if err := s.checkOptionAxes(current, p.OptionAxes); err != nil {
+		return p, err
+	}
+	updated, err := s.repo.Update(id, p)
+	return updated, s.productWriteError(id, p, err)
 }
 
 func (s *productService) Delete(id int) error {
 	return s.repo.Delete(id)
-}
\ No newline at end of file
+}
+
+// Restore undoes a soft delete. A product whose category has since been
+// deleted cannot come back until the category is restored.
+func (s *productService) Restore(id int) (models.Produk, error) {
+	p, err := s.repo.GetByIDIncludingDeleted(id)
+	if err != nil {
+		return p, err
+	}
+	if err := s.checkCategory(p.CategoryID); err != nil {
+		if errors.Is(err, ErrInvalidCategory) {
+			return p, ErrInvalidCategory.WithMessage(fmt.Sprintf("category %q of the product no longer exists; restore it first", p.CategoryID))
+		}
+		return p, err
+	}
+	return s.repo.Restore(id)
+}
+
+// CreateVariant adds a variant; its opening stock is recorded as a movement by actor.
+func (s *productService) CreateVariant(productID int, v models.ProductVariant, actor string) (models.ProductVariant, error) {
+	v.ProductID = productID
+	if err := s.validateVariant(&v); err != nil {
+		return v, err
+	}
+	return s.variantRepo.Create(v, actor)
+}
+
+// UpdateVariant replaces a variant. Like Update, it never changes stock.
+func (s *productService) UpdateVariant(productID, id int, v models.ProductVariant) (models.ProductVariant, error) {
+	v.ProductID = productID
+	if err := s.validateVariant(&v); err != nil {
+		return v, err
+	}
+	if v.Stok != 0 {
+		variants, err := s.variantRepo.GetByProductID(productID)
+		if err != nil {
+			return v, err
+		}
+		i := slices.IndexFunc(variants, func(current models.ProductVariant) bool { return current.ID == id })
+		if i < 0 {
+			return v, repositories.ErrVariantNotFound
+		}
+		if variants[i].Stok != v.Stok {
+			return v, ErrStockNotEditable
+		}
+	}
+	return s.variantRepo.Update(productID, id, v)
+}
+
+func (s *productService) DeleteVariant(productID, id int) error {
+	return s.variantRepo.Delete(productID, id)
+}
+
+// validateVariant checks a variant against its parent product: it must set
+// a non-empty value for exactly the product's option axes.
+func (s *productService) validateVariant(v *models.ProductVariant) error {
+	product, err := s.repo.GetByID(v.ProductID)
+	if err != nil {
+		return err
+	}
+	if len(product.OptionAxes) == 0 {
+		return validationError("product has no option_axes to build variants from")
+	}
+
+	v.SKU = strings.TrimSpace(v.SKU)
+	if len(v.SKU) > maxCodeLength {
+		return validationError(fmt.Sprintf("sku must be at most %d characters", maxCodeLength))
+	}
+	if v.Harga < 0 {
+		return validationError("harga must not be negative")
+	}
+	if v.HargaPokok < 0 {
+		return validationError("harga_pokok must not be negative")
+	}
+	if v.Stok < 0 {
+		return validationError("stok must not be negative")
+	}
+
+	options := make(map[string]string, len(product.OptionAxes))
+	for _, axis := range product.OptionAxes {
+		value := strings.TrimSpace(v.Options[axis])
+		if value == "" {
+			return validationError(fmt.Sprintf("options.%s is required", axis))
+		}
+		options[axis] = value
+	}
+	if len(v.Options) != len(options) {
+		return validationError("options may only set " + strings.Join(product.OptionAxes, ", "))
+	}
+	v.Options = options
+	return nil
+}
+
+// checkOptionAxes rejects changing the option axes of a product that
+// already has variants, since their options would no longer match.
+func (s *productService) checkOptionAxes(current models.Produk, axes []string) error {
+	if slices.Equal(current.OptionAxes, axes) {
+		return nil
+	}
+	variants, err := s.variantRepo.GetByProductID(current.ID)
+	if err != nil {
+		return err
+	}
+	if len(variants) > 0 {
+		return ErrOptionAxesInUse
+	}
+	return nil
+}
+
+// normalizeProduk trims the SKU, barcodes and option axes and drops repeated
+// barcodes and axes.
+func normalizeProduk(p models.Produk) models.Produk {
+	p.SKU = strings.TrimSpace(p.SKU)
+	p.Barcodes = trimUnique(p.Barcodes)
+	p.OptionAxes = trimUnique(p.OptionAxes)
+	return p
+}
+
+// trimUnique trims every value and drops repeats, keeping the first
+// occurrence. A nil slice stays nil so callers can tell "not given" apart.
+func trimUnique(values []string) []string {
+	if values == nil {
+		return nil
+	}
+	seen := make(map[string]bool, len(values))
+	unique := make([]string, 0, len(values))
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if !seen[v] {
+			seen[v] = true
+			unique = append(unique, v)
+		}
+	}
+	return unique
+}
+
+func validateProduk(p models.Produk) error {
+	if p.Nama == "" {
+		return validationError("nama is required")
+	}
+	if p.Harga < 0 {
+		return validationError("harga must not be negative")
+	}
+	if p.HargaPokok < 0 {
+		return validationError("harga_pokok must not be negative")
+	}
+	if p.Stok < 0 {
+		return validationError("stok must not be negative")
+	}
+	if p.ReorderPoint < 0 {
+		return validationError("reorder_point must not be negative")
+	}
+	if len(p.SKU) > maxCodeLength {
+		return validationError(fmt.Sprintf("sku must be at most %d characters", maxCodeLength))
+	}
+	for _, axis := range p.OptionAxes {
+		if axis == "" {
+			return validationError("option_axes must not be empty")
+		}
+	}
+	for _, code := range p.Barcodes {
+		if code == "" {
+			return validationError("barcodes must not be empty")
+		}
+		if len(code) > maxCodeLength {
+			return validationError(fmt.Sprintf("barcodes must be at most %d characters", maxCodeLength))
+		}
+	}
+	return nil
+}
+
+// productWriteError turns unique violations on the SKU and barcodes of p,
+// written as product id (0 when created), into ErrSKUTaken and
+// ErrBarcodeTaken, naming the product holding the code. Deleted products
+// keep their codes, so the error says when the holder is one. Unknown tax
+// rates become ErrInvalidTaxRate.
+func (s *productService) productWriteError(id int, p models.Produk, err error) error {
+	if !errors.Is(err, repositories.ErrDuplicate) {
+		return taxRateWriteError(err)
+	}
+	details, _ := apperrors.From(err).Details.(map[string]string)
+	var taken *apperrors.Error
+	var field string
+	var codes []string
+	var owners map[string]int
+	var lookupErr error
+	switch details["constraint"] {
+	case "products_sku_key":
+		taken, field, codes = ErrSKUTaken, "sku", []string{p.SKU}
+		owners, lookupErr = s.repo.GetIDsBySKU(codes)
+	case "product_barcodes_pkey":
+		taken, field, codes = ErrBarcodeTaken, "barcode", p.Barcodes
+		owners, lookupErr = s.repo.GetIDsByBarcode(codes)
+	default:
+		return err
+	}
+	if lookupErr != nil {
+		return taken.Wrap(err)
+	}
+
+	for _, code := range codes {
+		ownerID, ok := owners[code]
+		if !ok || ownerID == id {
+			continue
+		}
+		owner, lookupErr := s.repo.GetByIDIncludingDeleted(ownerID)
+		if lookupErr == nil && owner.DeletedAt != nil {
+			return taken.WithMessage(fmt.Sprintf("%s %q belongs to deleted product %d; restore it or use another %s", field, code, ownerID, field)).Wrap(err)
+		}
+		return taken.WithMessage(fmt.Sprintf("%s %q is already used by product %d", field, code, ownerID)).Wrap(err)
+	}
+	return taken.Wrap(err)
+}
+
+// checkCategory makes sure an optional category reference points to an existing category.
+func (s *productService) checkCategory(categoryID string) error {
+	if categoryID == "" {
+		return nil
+	}
+	_, err := s.categoryRepo.GetByID(categoryID)
+	if errors.Is(err, repositories.ErrCategoryNotFound) {
+		return ErrInvalidCategory
+	}
+	return err
+}
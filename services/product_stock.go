@@ -0,0 +1,72 @@
+package services
+
+import (
+	"category-api/models"
+	"fmt"
+	"strings"
+)
+
+// maxReferenceLength is the longest stock movement reference or actor the schema accepts.
+const maxReferenceLength = 100
+
+// AdjustStock records a manual stock movement: an adjustment by a signed
+// quantity, or receiving and transfers of a positive number of units.
+// Adjustments need a reason so the ledger can explain them later.
+func (s *productService) AdjustStock(productID int, req models.StockAdjustmentRequest) (models.StockMovement, error) {
+	req.Reason = strings.TrimSpace(req.Reason)
+	req.Reference = strings.TrimSpace(req.Reference)
+	req.Actor = strings.TrimSpace(req.Actor)
+
+	if !models.StockAdjustmentTypes[req.Type] {
+		return models.StockMovement{}, validationError("type must be one of adjustment, receiving, transfer_in, transfer_out")
+	}
+	quantity := req.Quantity
+	switch req.Type {
+	case models.StockAdjustment:
+		if quantity == 0 {
+			return models.StockMovement{}, validationError("quantity must not be 0")
+		}
+		if req.Reason == "" {
+			return models.StockMovement{}, validationError("reason is required for adjustments")
+		}
+	default:
+		if quantity <= 0 {
+			return models.StockMovement{}, validationError("quantity must be greater than 0")
+		}
+		if req.Type == models.StockTransferOut {
+			quantity = -quantity
+		}
+	}
+	if len(req.Reference) > maxReferenceLength {
+		return models.StockMovement{}, validationError(fmt.Sprintf("reference must be at most %d characters", maxReferenceLength))
+	}
+	if len(req.Actor) > maxReferenceLength {
+		return models.StockMovement{}, validationError(fmt.Sprintf("actor must be at most %d characters", maxReferenceLength))
+	}
+
+	return s.stockRepo.Adjust(models.StockMovement{
+		ProductID: productID,
+		VariantID: req.VariantID,
+		Type:      req.Type,
+		Quantity:  quantity,
+		Reason:    req.Reason,
+		Reference: req.Reference,
+		Actor:     req.Actor,
+	})
+}
+
+// GetLowStock lists the products and variants at or below their reorder
+// point, most urgent first, optionally within one category.
+func (s *productService) GetLowStock(categoryID string) ([]models.LowStockItem, error) {
+	return s.repo.GetLowStock(categoryID)
+}
+
+// GetStockMovements returns one page of a product's stock ledger, newest
+// first. The ledger of a deleted product stays readable.
+func (s *productService) GetStockMovements(filter models.StockMovementFilter) ([]models.StockMovement, int, error) {
+	if _, err := s.repo.GetByIDIncludingDeleted(filter.ProductID); err != nil {
+		return nil, 0, err
+	}
+	filter.Normalize()
+	return s.stockRepo.GetMovements(filter)
+}
@@ -0,0 +1,106 @@
+package services
+
+import (
+	"category-api/apperrors"
+	"category-api/models"
+	"category-api/repositories"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrPromoCodeTaken is returned when another promo code already has the code, ignoring case.
+var ErrPromoCodeTaken = apperrors.Conflict("promo_code_taken", "a promo code with this code already exists")
+
+// maxPromoCodeLength is the longest promo code the schema accepts.
+const maxPromoCodeLength = 50
+
+type PromoService interface {
+	GetAll() ([]models.PromoCode, error)
+	GetByID(id int) (models.PromoCode, error)
+	Create(p models.PromoCode) (models.PromoCode, error)
+	Update(id int, p models.PromoCode) (models.PromoCode, error)
+	Delete(id int) error
+}
+
+type promoService struct {
+	repo repositories.PromoRepository
+}
+
+func NewPromoService(repo repositories.PromoRepository) PromoService {
+	return &promoService{repo}
+}
+
+func (s *promoService) GetAll() ([]models.PromoCode, error) {
+	return s.repo.GetAll()
+}
+
+func (s *promoService) GetByID(id int) (models.PromoCode, error) {
+	return s.repo.GetByID(id)
+}
+
+// Create adds a promo code. Codes are stored upper case.
+func (s *promoService) Create(p models.PromoCode) (models.PromoCode, error) {
+	if err := validatePromo(&p); err != nil {
+		return p, err
+	}
+	created, err := s.repo.Create(p)
+	return created, promoWriteError(err)
+}
+
+// Update replaces the settings of a promo code; its usage count is kept.
+func (s *promoService) Update(id int, p models.PromoCode) (models.PromoCode, error) {
+	if err := validatePromo(&p); err != nil {
+		return p, err
+	}
+	updated, err := s.repo.Update(id, p)
+	return updated, promoWriteError(err)
+}
+
+func (s *promoService) Delete(id int) error {
+	return s.repo.Delete(id)
+}
+
+// validatePromo normalizes the code of p and checks its settings.
+func validatePromo(p *models.PromoCode) error {
+	p.Code = strings.ToUpper(strings.TrimSpace(p.Code))
+	switch {
+	case p.Code == "":
+		return validationError("code is required")
+	case len(p.Code) > maxPromoCodeLength || strings.ContainsAny(p.Code, " \t\n"):
+		return validationError(fmt.Sprintf("code must be at most %d characters without spaces", maxPromoCodeLength))
+	case p.MinSpend < 0:
+		return validationError("min_spend must not be negative")
+	case p.UsageLimit < 0:
+		return validationError("usage_limit must not be negative")
+	case p.StartsAt != nil && p.EndsAt != nil && !p.EndsAt.After(*p.StartsAt):
+		return validationError("ends_at must be after starts_at")
+	}
+	return validateDiscount("discount", p.Discount)
+}
+
+// validateDiscount checks the type and value of a discount; field names it
+// in the error.
+func validateDiscount(field string, d models.Discount) error {
+	switch d.Type {
+	case models.DiscountPercentage:
+		if d.Value <= 0 || d.Value > 100 {
+			return validationError(field + " value must be a percentage between 1 and 100")
+		}
+	case models.DiscountFixed:
+		if d.Value <= 0 {
+			return validationError(field + " value must be greater than 0")
+		}
+	default:
+		return validationError(field + " type must be percentage or fixed")
+	}
+	return nil
+}
+
+// promoWriteError turns a unique violation on the code into ErrPromoCodeTaken.
+func promoWriteError(err error) error {
+	if errors.Is(err, repositories.ErrDuplicate) {
+		return ErrPromoCodeTaken.Wrap(err)
+	}
+	return err
+}
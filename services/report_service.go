@@ -1,41 +1,128 @@
 package services
 
 import (
+	"category-api/apperrors"
 	"category-api/models"
 	"category-api/repositories"
+	"time"
 )
 
+// maxReportDays bounds the length of a report period.
+const maxReportDays = 366
+
+// ErrInvalidDateRange is returned when a report period is reversed or too long.
+var ErrInvalidDateRange = apperrors.BadRequest("invalid_date_range", "end_date must not be before start_date and the period must not exceed 366 days")
+
 type ReportService interface {
 	GetDailyReport() (models.DailyReportResponse, error)
+	GetReport(startDate, endDate time.Time) (models.SalesReportResponse, error)
 }
 
 type reportService struct {
 	transactionRepo repositories.TransactionRepository
+	businessDay     BusinessDay
 }
 
-func NewReportService(transactionRepo repositories.TransactionRepository) ReportService {
-	return &reportService{transactionRepo}
+func NewReportService(transactionRepo repositories.TransactionRepository, businessDay BusinessDay) ReportService {
+	return &reportService{transactionRepo, businessDay}
 }
 
 func (s *reportService) GetDailyReport() (models.DailyReportResponse, error) {
-	revenue, err := s.transactionRepo.GetTodayRevenue()
+	report, err := s.GetReport(time.Time{}, time.Time{})
 	if err != nil {
 		return models.DailyReportResponse{}, err
 	}
+	return report.DailyReportResponse, nil
+}
+
+// GetReport builds the sales report for the business days startDate through
+// endDate, both inclusive. A zero date stands for the current business day.
+func (s *reportService) GetReport(startDate, endDate time.Time) (models.SalesReportResponse, error) {
+	if startDate.IsZero() {
+		startDate = s.businessDay.Today()
+	}
+	if endDate.IsZero() {
+		endDate = s.businessDay.Today()
+	}
+	if endDate.Before(startDate) || !endDate.Before(startDate.AddDate(0, 0, maxReportDays)) {
+		return models.SalesReportResponse{}, ErrInvalidDateRange
+	}
+	start := s.businessDay.Start(startDate)
+	end := s.businessDay.Start(endDate.AddDate(0, 0, 1))
 
-	count, err := s.transactionRepo.GetTodayTransactionCount()
+	revenue, err := s.transactionRepo.GetRevenue(start, end)
 	if err != nil {
-		return models.DailyReportResponse{}, err
+		return models.SalesReportResponse{}, err
 	}
 
-	bestProduct, err := s.transactionRepo.GetTodayBestSellingProduct()
+	breakdown, err := s.transactionRepo.GetSalesBreakdown(start, end)
 	if err != nil {
-		return models.DailyReportResponse{}, err
+		return models.SalesReportResponse{}, err
+	}
+
+	tax, err := s.transactionRepo.GetTaxSummary(start, end)
+	if err != nil {
+		return models.SalesReportResponse{}, err
+	}
+
+	count, err := s.transactionRepo.GetTransactionCount(start, end)
+	if err != nil {
+		return models.SalesReportResponse{}, err
+	}
+
+	bestProduct, err := s.transactionRepo.GetBestSellingProduct(start, end)
+	if err != nil {
+		return models.SalesReportResponse{}, err
+	}
+
+	sales, err := s.transactionRepo.GetDailySales(start, end, s.businessDay.TimezoneName(), s.businessDay.CutoffHour)
+	if err != nil {
+		return models.SalesReportResponse{}, err
+	}
+
+	grossProfit, err := s.transactionRepo.GetGrossProfit(start, end)
+	if err != nil {
+		return models.SalesReportResponse{}, err
+	}
+	if grossProfit.PerProduk == nil {
+		grossProfit.PerProduk = []models.ProductGrossProfit{}
+	}
+	if grossProfit.PerKategori == nil {
+		grossProfit.PerKategori = []models.CategoryGrossProfit{}
 	}
 
-	return models.DailyReportResponse{
-		TotalRevenue:   revenue,
-		TotalTransaksi: count,
-		ProdukTerlaris: bestProduct,
+	return models.SalesReportResponse{
+		StartDate: startDate.Format("2006-01-02"),
+		EndDate:   endDate.Format("2006-01-02"),
+		DailyReportResponse: models.DailyReportResponse{
+			TotalRevenue:   revenue,
+			TotalTransaksi: count,
+			Penjualan:      breakdown,
+			Pajak:          tax,
+			ProdukTerlaris: bestProduct,
+			LabaKotor:      grossProfit,
+		},
+		Harian: fillDailySales(startDate, endDate, sales),
 	}, nil
-}
\ No newline at end of file
+}
+
+// fillDailySales returns one entry per date from startDate through endDate,
+// using zero totals for days missing from sales so the series can be charted
+// directly.
+func fillDailySales(startDate, endDate time.Time, sales []models.DailySales) []models.DailySales {
+	byDate := make(map[string]models.DailySales, len(sales))
+	for _, day := range sales {
+		byDate[day.Tanggal] = day
+	}
+
+	var series []models.DailySales
+	for d := startDate; !d.After(endDate); d = d.AddDate(0, 0, 1) {
+		date := d.Format("2006-01-02")
+		day, ok := byDate[date]
+		if !ok {
+			day = models.DailySales{Tanggal: date}
+		}
+		series = append(series, day)
+	}
+	return series
+}
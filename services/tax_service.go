@@ -0,0 +1,105 @@
+package services
+
+import (
+	"category-api/apperrors"
+	"category-api/models"
+	"category-api/repositories"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+var (
+	// ErrTaxRateNameTaken is returned when another tax rate already has the name, ignoring case.
+	ErrTaxRateNameTaken = apperrors.Conflict("tax_rate_name_taken", "a tax rate with this name already exists")
+	// ErrInvalidTaxRate is returned when a product or category references a tax rate that does not exist.
+	ErrInvalidTaxRate = apperrors.Unprocessable("invalid_tax_rate", "tax_rate_id does not reference an existing tax rate")
+)
+
+// maxTaxRateNameLength is the longest tax rate name the schema accepts.
+const maxTaxRateNameLength = 50
+
+type TaxService interface {
+	GetAll() ([]models.TaxRate, error)
+	GetByID(id int) (models.TaxRate, error)
+	Create(t models.TaxRate) (models.TaxRate, error)
+	Update(id int, t models.TaxRate) (models.TaxRate, error)
+	Delete(id int) error
+}
+
+type taxService struct {
+	repo repositories.TaxRepository
+}
+
+func NewTaxService(repo repositories.TaxRepository) TaxService {
+	return &taxService{repo}
+}
+
+func (s *taxService) GetAll() ([]models.TaxRate, error) {
+	return s.repo.GetAll()
+}
+
+func (s *taxService) GetByID(id int) (models.TaxRate, error) {
+	return s.repo.GetByID(id)
+}
+
+// Create adds a tax rate. Making it the default replaces the current default.
+func (s *taxService) Create(t models.TaxRate) (models.TaxRate, error) {
+	if err := validateTaxRate(&t); err != nil {
+		return t, err
+	}
+	created, err := s.repo.Create(t)
+	return created, taxRateNameError(err)
+}
+
+// Update replaces the settings of a tax rate. Sales already made keep the
+// rate they were taxed at.
+func (s *taxService) Update(id int, t models.TaxRate) (models.TaxRate, error) {
+	if err := validateTaxRate(&t); err != nil {
+		return t, err
+	}
+	updated, err := s.repo.Update(id, t)
+	return updated, taxRateNameError(err)
+}
+
+func (s *taxService) Delete(id int) error {
+	return s.repo.Delete(id)
+}
+
+// validateTaxRate normalizes the name and rate of t and checks them. Rates
+// are kept to two decimals, as stored.
+func validateTaxRate(t *models.TaxRate) error {
+	t.Name = strings.TrimSpace(t.Name)
+	t.Rate = math.Round(t.Rate*100) / 100
+	switch {
+	case t.Name == "":
+		return validationError("name is required")
+	case len(t.Name) > maxTaxRateNameLength:
+		return validationError(fmt.Sprintf("name must be at most %d characters", maxTaxRateNameLength))
+	case t.Rate < 0 || t.Rate > 100:
+		return validationError("rate must be a percentage between 0 and 100")
+	}
+	return nil
+}
+
+// taxRateNameError turns a unique violation on the name into ErrTaxRateNameTaken.
+func taxRateNameError(err error) error {
+	if errors.Is(err, repositories.ErrDuplicate) {
+		return ErrTaxRateNameTaken.Wrap(err)
+	}
+	return err
+}
+
+// taxRateWriteError turns a foreign key violation on the tax_rate_id of a
+// product or category into ErrInvalidTaxRate.
+func taxRateWriteError(err error) error {
+	if !errors.Is(err, repositories.ErrForeignKeyViolation) {
+		return err
+	}
+	details, _ := apperrors.From(err).Details.(map[string]string)
+	if strings.HasSuffix(details["constraint"], "_tax_rate_id_fkey") {
+		return ErrInvalidTaxRate.Wrap(err)
+	}
+	return err
+}
@@ -1,56 +1,352 @@
 package services
 
 import (
+	"category-api/apperrors"
 	"category-api/models"
+	"category-api/notifier"
 	"category-api/repositories"
-	"errors"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrIdempotencyKeyMismatch is returned when a key is reused with a different request body.
+	ErrIdempotencyKeyMismatch = apperrors.Unprocessable("idempotency_key_mismatch", "idempotency key was already used with a different request")
+	// ErrIdempotencyInProgress is returned while the first request using a key has not finished.
+	ErrIdempotencyInProgress = apperrors.Conflict("idempotency_in_progress", "a request with this idempotency key is still being processed")
+	// ErrInvalidCursor is returned when a pagination cursor cannot be decoded.
+	ErrInvalidCursor = apperrors.BadRequest("invalid_cursor", "invalid cursor")
+	// ErrInvalidReasonCode is returned when a void or refund has an unknown reason code.
+	ErrInvalidReasonCode = apperrors.BadRequest("invalid_reason_code", "invalid reason_code")
+)
+
+const (
+	defaultTransactionPageSize = 20
+	maxTransactionPageSize     = 100
 )
 
 type TransactionService interface {
 	Checkout(req models.CheckoutRequest) (models.CheckoutResponse, error)
+	CheckoutIdempotent(key string, req models.CheckoutRequest) (models.CheckoutResponse, bool, error)
+	ListTransactions(filter models.TransactionFilter, cursor string) (models.TransactionListResponse, error)
+	Export(filter models.TransactionFilter, fn func(models.Transaction) error) error
+	GetTransaction(id int) (models.TransactionDetailResponse, error)
+	Void(id int, req models.VoidRequest) (models.Reversal, error)
+	Refund(id int, req models.RefundRequest) (models.Reversal, error)
 }
 
 type transactionService struct {
 	transactionRepo repositories.TransactionRepository
-	productRepo     repositories.ProductRepository
+	reversalRepo    repositories.ReversalRepository
+	idempotencyRepo repositories.IdempotencyRepository
+	idempotencyTTL  time.Duration
+	businessDay     BusinessDay
+	notifier        notifier.Notifier
 }
 
-func NewTransactionService(transactionRepo repositories.TransactionRepository, productRepo repositories.ProductRepository) TransactionService {
-	return &transactionService{transactionRepo, productRepo}
+func NewTransactionService(transactionRepo repositories.TransactionRepository, reversalRepo repositories.ReversalRepository, idempotencyRepo repositories.IdempotencyRepository, idempotencyTTL time.Duration, businessDay BusinessDay, notifier notifier.Notifier) TransactionService {
+	return &transactionService{transactionRepo, reversalRepo, idempotencyRepo, idempotencyTTL, businessDay, notifier}
 }
 
 func (s *transactionService) Checkout(req models.CheckoutRequest) (models.CheckoutResponse, error) {
+	req, err := normalizeCheckout(req)
+	if err != nil {
+		return models.CheckoutResponse{}, err
+	}
+	return s.checkout(req, "")
+}
+
+// normalizeCheckout validates req and returns it with its promo code trimmed.
+func normalizeCheckout(req models.CheckoutRequest) (models.CheckoutRequest, error) {
 	if len(req.Items) == 0 {
-		return models.CheckoutResponse{}, errors.New("items cannot be empty")
+		return req, validationError("items cannot be empty")
 	}
 
-	// Validate products and stock
-	products := make(map[int]models.Produk)
 	for _, item := range req.Items {
 		if item.Quantity <= 0 {
-			return models.CheckoutResponse{}, errors.New("quantity must be greater than 0")
+			return req, validationError("quantity must be greater than 0")
+		}
+		if item.ProductID == 0 && item.VariantID == 0 && item.Barcode == "" {
+			return req, validationError("each item needs product_id, variant_id or barcode")
+		}
+		if item.ProductID != 0 && item.Barcode != "" {
+			return req, validationError("product_id and barcode cannot be combined")
+		}
+		if item.Discount != nil {
+			if err := validateDiscount("item discount", *item.Discount); err != nil {
+				return req, err
+			}
+		}
+	}
+	if req.Discount != nil {
+		if err := validateDiscount("discount", *req.Discount); err != nil {
+			return req, err
 		}
+	}
+	req.PromoCode = strings.TrimSpace(req.PromoCode)
+	return req, nil
+}
 
-		product, err := s.productRepo.GetByID(item.ProductID)
-		if err != nil {
-			return models.CheckoutResponse{}, errors.New("product not found")
+// checkout sells the normalized req, completing idempotencyKey, when not
+// empty, in the same database transaction.
+func (s *transactionService) checkout(req models.CheckoutRequest, idempotencyKey string) (models.CheckoutResponse, error) {
+	// Stock is checked and decremented, the promo code redeemed and every
+	// line taxed at its product's rate atomically by the repository
+	sale, lowStock, err := s.transactionRepo.CreateTransaction(req, idempotencyKey)
+	if err != nil {
+		return models.CheckoutResponse{}, err
+	}
+	transaction := sale.Transaction
+	transaction.CreatedAt = s.businessDay.In(transaction.CreatedAt)
+
+	// The sale is committed; alerts are delivered in the background so a
+	// slow or failing channel never delays or fails the checkout
+	if len(lowStock) > 0 {
+		go s.notifyLowStock(models.LowStockAlert{
+			TransactionID: transaction.ID,
+			Items:         lowStock,
+			CreatedAt:     transaction.CreatedAt,
+		})
+	}
+
+	return models.CheckoutResponse{
+		Transaction: transaction,
+		Details:     sale.Details,
+		Discounts:   sale.Discounts,
+	}, nil
+}
+
+// notifyLowStock delivers a low-stock alert. It runs after the sale has
+// committed, so a missing notifier is a no-op and a panicking channel is
+// logged rather than allowed to take the server down.
+func (s *transactionService) notifyLowStock(alert models.LowStockAlert) {
+	if s.notifier == nil {
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Low-stock alert for transaction %d panicked: %v", alert.TransactionID, r)
 		}
+	}()
+	if err := s.notifier.NotifyLowStock(alert); err != nil {
+		log.Printf("Failed to deliver low-stock alert for transaction %d: %v", alert.TransactionID, err)
+	}
+}
+
+// CheckoutIdempotent performs a checkout guarded by an idempotency key. A
+// repeated key with the same request replays the stored response (reported by
+// the boolean result) instead of creating another sale. The response is
+// stored in the checkout's own database transaction.
+func (s *transactionService) CheckoutIdempotent(key string, req models.CheckoutRequest) (models.CheckoutResponse, bool, error) {
+	req, err := normalizeCheckout(req)
+	if err != nil {
+		return models.CheckoutResponse{}, false, err
+	}
+	hash, err := hashCheckoutRequest(req)
+	if err != nil {
+		return models.CheckoutResponse{}, false, err
+	}
 
-		if product.Stok < item.Quantity {
-			return models.CheckoutResponse{}, errors.New("insufficient stock for product: " + product.Nama)
+	record, reserved, err := s.idempotencyRepo.Reserve(key, hash, time.Now().Add(s.idempotencyTTL))
+	if err != nil {
+		return models.CheckoutResponse{}, false, err
+	}
+	if !reserved {
+		if record.RequestHash != hash {
+			return models.CheckoutResponse{}, false, ErrIdempotencyKeyMismatch
 		}
+		if record.StatusCode == 0 {
+			return models.CheckoutResponse{}, false, ErrIdempotencyInProgress
+		}
+		var stored models.CheckoutResponse
+		if err := json.Unmarshal(record.Response, &stored); err != nil {
+			return models.CheckoutResponse{}, false, err
+		}
+		stored.Transaction.CreatedAt = s.businessDay.In(stored.Transaction.CreatedAt)
+		return stored, true, nil
+	}
 
-		products[item.ProductID] = product
+	response, err := s.checkout(req, key)
+	if err != nil {
+		// Nothing was sold, so let the client retry with the same key
+		if releaseErr := s.idempotencyRepo.Release(key); releaseErr != nil {
+			log.Printf("Failed to release idempotency key %q: %v", key, releaseErr)
+		}
+		return models.CheckoutResponse{}, false, err
 	}
+	return response, false, nil
+}
 
-	// Create transaction
-	transaction, details, err := s.transactionRepo.CreateTransaction(req.Items, products)
+// hashCheckoutRequest fingerprints the decoded request, so formatting
+// differences in the JSON body do not count as a different request.
+func hashCheckoutRequest(req models.CheckoutRequest) (string, error) {
+	body, err := json.Marshal(req)
 	if err != nil {
-		return models.CheckoutResponse{}, err
+		return "", err
 	}
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:]), nil
+}
 
-	return models.CheckoutResponse{
+// ListTransactions returns one page of the transaction history. cursor is
+// the opaque next_cursor of the previous page, or empty for the first page.
+func (s *transactionService) ListTransactions(filter models.TransactionFilter, cursor string) (models.TransactionListResponse, error) {
+	filter = s.businessDayRange(filter)
+	if cursor != "" {
+		afterID, err := decodeCursor(cursor)
+		if err != nil {
+			return models.TransactionListResponse{}, err
+		}
+		filter.AfterID = afterID
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = defaultTransactionPageSize
+	}
+	if filter.Limit > maxTransactionPageSize {
+		filter.Limit = maxTransactionPageSize
+	}
+
+	// Fetch one extra row to learn whether another page exists
+	pageSize := filter.Limit
+	filter.Limit++
+	transactions, err := s.transactionRepo.List(filter)
+	if err != nil {
+		return models.TransactionListResponse{}, err
+	}
+
+	for i := range transactions {
+		transactions[i].CreatedAt = s.businessDay.In(transactions[i].CreatedAt)
+	}
+
+	response := models.TransactionListResponse{Data: transactions}
+	if len(transactions) > pageSize {
+		response.Data = transactions[:pageSize]
+		response.NextCursor = encodeCursor(response.Data[pageSize-1].ID)
+	}
+	if response.Data == nil {
+		response.Data = []models.Transaction{}
+	}
+	return response, nil
+}
+
+// Export streams every transaction matching filter to fn, oldest first. The
+// cursor and limit of filter are ignored.
+func (s *transactionService) Export(filter models.TransactionFilter, fn func(models.Transaction) error) error {
+	filter = s.businessDayRange(filter)
+	filter.AfterID, filter.Limit = 0, 0
+	return s.transactionRepo.Each(filter, func(t models.Transaction) error {
+		t.CreatedAt = s.businessDay.In(t.CreatedAt)
+		return fn(t)
+	})
+}
+
+// businessDayRange turns the inclusive business dates of filter into the
+// instants the repository compares created_at with.
+func (s *transactionService) businessDayRange(filter models.TransactionFilter) models.TransactionFilter {
+	if !filter.StartDate.IsZero() {
+		filter.StartDate = s.businessDay.Start(filter.StartDate)
+	}
+	if !filter.EndDate.IsZero() {
+		filter.EndDate = s.businessDay.Start(filter.EndDate.AddDate(0, 0, 1))
+	}
+	return filter
+}
+
+func (s *transactionService) GetTransaction(id int) (models.TransactionDetailResponse, error) {
+	transaction, details, err := s.transactionRepo.GetByID(id)
+	if err != nil {
+		return models.TransactionDetailResponse{}, err
+	}
+	transaction.CreatedAt = s.businessDay.In(transaction.CreatedAt)
+
+	discounts, err := s.transactionRepo.GetDiscounts(id)
+	if err != nil {
+		return models.TransactionDetailResponse{}, err
+	}
+
+	reversals, err := s.reversalRepo.GetByTransactionID(id)
+	if err != nil {
+		return models.TransactionDetailResponse{}, err
+	}
+	for i := range reversals {
+		reversals[i].CreatedAt = s.businessDay.In(reversals[i].CreatedAt)
+	}
+	if reversals == nil {
+		reversals = []models.Reversal{}
+	}
+
+	return models.TransactionDetailResponse{
 		Transaction: transaction,
 		Details:     details,
+		Discounts:   discounts,
+		Reversals:   reversals,
 	}, nil
-}
\ No newline at end of file
+}
+
+// Void cancels a whole transaction, restocking everything it sold.
+func (s *transactionService) Void(id int, req models.VoidRequest) (models.Reversal, error) {
+	if !models.ReasonCodes[req.ReasonCode] {
+		return models.Reversal{}, ErrInvalidReasonCode.WithDetails(reasonCodeList())
+	}
+	reversal, err := s.reversalRepo.Void(id, req)
+	if err != nil {
+		return models.Reversal{}, err
+	}
+	reversal.CreatedAt = s.businessDay.In(reversal.CreatedAt)
+	return reversal, nil
+}
+
+// Refund returns some of the lines of a transaction, restocking them.
+func (s *transactionService) Refund(id int, req models.RefundRequest) (models.Reversal, error) {
+	if !models.ReasonCodes[req.ReasonCode] {
+		return models.Reversal{}, ErrInvalidReasonCode.WithDetails(reasonCodeList())
+	}
+	if len(req.Items) == 0 {
+		return models.Reversal{}, repositories.ErrInvalidRefund.WithMessage("items cannot be empty")
+	}
+	for _, item := range req.Items {
+		if item.Quantity <= 0 {
+			return models.Reversal{}, repositories.ErrInvalidRefund.WithMessage("quantity must be greater than 0")
+		}
+	}
+
+	reversal, err := s.reversalRepo.Refund(id, req)
+	if err != nil {
+		return models.Reversal{}, err
+	}
+	reversal.CreatedAt = s.businessDay.In(reversal.CreatedAt)
+	return reversal, nil
+}
+
+// reasonCodeList returns the accepted reason codes in a stable order.
+func reasonCodeList() []string {
+	codes := make([]string, 0, len(models.ReasonCodes))
+	for code := range models.ReasonCodes {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+func encodeCursor(id int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(id)))
+}
+
+func decodeCursor(cursor string) (int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+	id, err := strconv.Atoi(string(raw))
+	if err != nil || id <= 0 {
+		return 0, ErrInvalidCursor
+	}
+	return id, nil
+}